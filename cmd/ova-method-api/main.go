@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/jmoiron/sqlx"
 	"google.golang.org/grpc"
+	_ "modernc.org/sqlite"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -31,16 +33,23 @@ import (
 	"ova-method-api/internal"
 	"ova-method-api/internal/app"
 	"ova-method-api/internal/app/middleware"
+	"ova-method-api/internal/deadletter"
+	"ova-method-api/internal/migrate"
 	"ova-method-api/internal/monitoring"
 	iqueue "ova-method-api/internal/queue"
 	"ova-method-api/internal/repo"
+	"ova-method-api/migrations"
 	igrpc "ova-method-api/pkg/ova-method-api"
 )
 
 var (
 	conn          *sqlx.DB
+	replicaConns  []*sqlx.DB
+	replicas      repo.Replicas
 	tracingCloser io.Closer
 	queue         iqueue.Queue
+	deadLetters   deadletter.Handler
+	stopRetry     context.CancelFunc
 	httpServer    *http.Server
 	grpcServer    *grpc.Server
 )
@@ -49,13 +58,22 @@ func main() {
 	config := getConfig()
 
 	initLogger(config)
+
+	if len(os.Args) > 1 {
+		runCommand(config, os.Args[1:])
+		return
+	}
+
 	initOpentracing(config)
 
-	connectToQueue(config)
 	connectToDatabase(config)
+	autoMigrate(config)
+	connectToQueue(config)
+	initDeadLetters(config)
 
+	startDeadLetterRetry(config)
 	startHttpServer(config)
-	startGrpcServer(config, repo.NewMethodRepo(conn))
+	startGrpcServer(config, newMethodRepo(config))
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
@@ -125,34 +143,259 @@ func initOpentracing(config *internal.Application) {
 }
 
 func connectToQueue(config *internal.Application) {
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Producer.Return.Successes = true
+	saramaConfig, err := makeSaramaConfig(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid kafka config")
+	}
 
-	queue = iqueue.NewKafkaProvider(config.Kafka.Brokers, saramaConfig)
+	if config.Kafka.Async {
+		queue = iqueue.NewAsyncKafkaProvider(config.Kafka.Brokers, saramaConfig, makeQueueCallbacks())
+	} else {
+		queue = iqueue.NewKafkaProvider(config.Kafka.Brokers, saramaConfig)
+	}
 
 	if err := queue.Connect(); err != nil {
 		log.Fatal().Err(err).Msg("failed connect to queue")
 	}
 }
 
+func makeSaramaConfig(config *internal.Application) (*sarama.Config, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.Return.Successes = true
+	// record headers are supported since kafka 0.11
+	saramaConfig.Version = sarama.V0_11_0_0
+
+	if config.Kafka.Version != "" {
+		version, err := sarama.ParseKafkaVersion(config.Kafka.Version)
+		if err != nil {
+			return nil, err
+		}
+		saramaConfig.Version = version
+	}
+
+	if config.Kafka.ClientId != "" {
+		saramaConfig.ClientID = config.Kafka.ClientId
+	}
+
+	if config.Kafka.Acks != "" {
+		acks, err := iqueue.ParseRequiredAcks(config.Kafka.Acks)
+		if err != nil {
+			return nil, err
+		}
+		saramaConfig.Producer.RequiredAcks = acks
+	}
+
+	compression, err := iqueue.ParseCompressionCodec(config.Kafka.Compression)
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Producer.Compression = compression
+
+	if config.Kafka.Retries != nil {
+		saramaConfig.Producer.Retry.Max = *config.Kafka.Retries
+	}
+	if config.Kafka.RetryBackoffMs > 0 {
+		saramaConfig.Producer.Retry.Backoff = config.Kafka.GetRetryBackoff()
+	}
+
+	if config.Kafka.Idempotent {
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+		saramaConfig.Net.MaxOpenRequests = 1
+	}
+
+	if config.Kafka.Async {
+		saramaConfig.ChannelBufferSize = config.Kafka.ChannelBufferSize
+		saramaConfig.Producer.Flush.Frequency = config.Kafka.GetFlushFrequency()
+		saramaConfig.Producer.Flush.Messages = config.Kafka.FlushMessages
+		saramaConfig.Producer.Flush.Bytes = config.Kafka.FlushBytes
+	}
+
+	if config.Kafka.Tls.Enabled {
+		tlsConfig, err := iqueue.NewTLSConfig(
+			config.Kafka.Tls.CaFile,
+			config.Kafka.Tls.CertFile,
+			config.Kafka.Tls.KeyFile,
+			config.Kafka.Tls.InsecureSkipVerify,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	if config.Kafka.Sasl.Enabled {
+		mechanism, err := iqueue.ParseSASLMechanism(config.Kafka.Sasl.Mechanism)
+		if err != nil {
+			return nil, err
+		}
+
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.Mechanism = mechanism
+		saramaConfig.Net.SASL.User = config.Kafka.Sasl.User
+		saramaConfig.Net.SASL.Password = config.Kafka.Sasl.Pass
+
+		if mechanism != sarama.SASLTypePlaintext {
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = iqueue.NewScramClientGenerator(mechanism)
+		}
+	}
+
+	return saramaConfig, saramaConfig.Validate()
+}
+
+func makeQueueCallbacks() iqueue.AsyncCallbacks {
+	sent := promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_messages_sent",
+		Help: "number of messages acknowledged by the queue",
+	}, []string{"topic"})
+
+	failed := promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "queue_messages_failed",
+		Help: "number of messages rejected by the queue",
+	}, []string{"topic"})
+
+	return iqueue.AsyncCallbacks{
+		OnSuccess: func(topic string) {
+			sent.WithLabelValues(topic).Inc()
+		},
+		OnError: func(topic string, msg iqueue.QueueMsg, err error) {
+			failed.WithLabelValues(topic).Inc()
+
+			if deadLetters == nil || msg == nil {
+				return
+			}
+			if storeErr := deadLetters.Store(context.Background(), topic, msg, err); storeErr != nil {
+				log.Error().Err(storeErr).Str("topic", topic).Msg("failed store dead letter")
+			}
+		},
+	}
+}
+
+func initDeadLetters(config *internal.Application) {
+	if !config.DeadLetter.Enabled {
+		return
+	}
+
+	metrics := deadletter.Metrics{
+		Stored: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "dead_letters_stored",
+			Help: "number of queue messages stored as dead letters",
+		}),
+		Resent: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "dead_letters_resent",
+			Help: "number of dead letters successfully resent",
+		}),
+		Failed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "dead_letters_failed",
+			Help: "number of failed dead letter resend attempts",
+		}),
+	}
+
+	deadLetters = deadletter.New(queue, repo.NewDeadLetterRepo(conn), deadletter.Config{
+		MaxAttempts: config.DeadLetter.MaxAttempts,
+		BatchSize:   config.DeadLetter.BatchSize,
+		BackoffBase: config.DeadLetter.GetBackoffBase(),
+		BackoffMax:  config.DeadLetter.GetBackoffMax(),
+	}, metrics)
+
+	queue = deadletter.NewQueue(queue, deadLetters)
+}
+
+func startDeadLetterRetry(config *internal.Application) {
+	if deadLetters == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopRetry = cancel
+
+	go deadletter.RunRetry(ctx, deadLetters, config.DeadLetter.GetRetryInterval())
+}
+
+func makeRepoOptions(config *internal.Application) []repo.Option {
+	opts := []repo.Option{repo.WithTimeouts(repo.Timeouts{
+		Read:  config.Database.GetReadTimeout(),
+		Write: config.Database.GetWriteTimeout(),
+		Bulk:  config.Database.GetBulkTimeout(),
+	})}
+	if config.Database.TxMaxAttempts > 0 {
+		opts = append(opts, repo.WithTxMaxAttempts(config.Database.TxMaxAttempts))
+	}
+	if replicas != nil {
+		opts = append(opts, repo.WithReplicas(replicas))
+	}
+	return opts
+}
+
+// methodRepoFactory returns the constructor of the method repository for the database driver.
+func methodRepoFactory(config *internal.Application) repo.MethodRepoFactory {
+	if config.Database.Driver == "sqlite" {
+		return repo.NewSQLiteMethodRepo
+	}
+	return repo.NewMethodRepo
+}
+
+func newMethodRepo(config *internal.Application) repo.MethodRepo {
+	return methodRepoFactory(config)(conn, makeRepoOptions(config)...)
+}
+
 func connectToDatabase(config *internal.Application) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.Database.GetConnTimeout())
-	defer cancel()
+	dsn, err := config.Database.String()
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid db config")
+	}
 
-	db, err := sqlx.Open(config.Database.Driver, config.Database.String())
+	db, err := openDatabase(config, dsn)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed create db connection")
+		log.Fatal().Err(err).Msg("failed connect to db")
 	}
+	conn = db
+
+	if len(config.Database.Replicas) == 0 {
+		return
+	}
+
+	replicaConns = make([]*sqlx.DB, 0, len(config.Database.Replicas))
+	healthChecked := make([]repo.ReplicaConnection, 0, len(config.Database.Replicas))
+	for _, replica := range config.Database.Replicas {
+		dsn, err = config.Database.ReplicaString(replica)
+		if err != nil {
+			log.Fatal().Err(err).Str("host", replica.Host).Msg("invalid db replica config")
+		}
 
-	if err = db.PingContext(ctx); err != nil {
-		log.Fatal().Err(err).Msg("failed ping db connection")
+		db, err = openDatabase(config, dsn)
+		if err != nil && db == nil {
+			log.Fatal().Err(err).Str("host", replica.Host).Msg("failed create db replica connection")
+		}
+		// an unavailable replica is skipped until the health check succeeds
+		if err != nil {
+			log.Error().Err(err).Str("host", replica.Host).Msg("failed connect to db replica")
+		}
+
+		replicaConns = append(replicaConns, db)
+		healthChecked = append(healthChecked, db)
+	}
+
+	replicas = repo.NewReplicas(healthChecked, config.Database.GetReplicaCheckInterval(), config.Database.GetConnTimeout())
+}
+
+// openDatabase returns the connection pool even if the ping failed, so the caller may decide to use it.
+func openDatabase(config *internal.Application, dsn string) (*sqlx.DB, error) {
+	db, err := sqlx.Open(config.Database.Driver, dsn)
+	if err != nil {
+		return nil, err
 	}
 
 	db.SetMaxOpenConns(config.Database.MaxOpenConns)
 	db.SetMaxIdleConns(config.Database.MaxIdleConns)
 	db.SetConnMaxLifetime(config.Database.GetConnMaxLifetime())
 
-	conn = db
+	ctx, cancel := context.WithTimeout(context.Background(), config.Database.GetConnTimeout())
+	defer cancel()
+
+	return db, db.PingContext(ctx)
 }
 
 func startHttpServer(config *internal.Application) {
@@ -189,12 +432,32 @@ func startGrpcServer(config *internal.Application, rep repo.MethodRepo) {
 
 	tracing := middleware.NewTracingMiddleware(config.Tracing.GrpcEndpoints)
 	statusMonitoring := middleware.NewStatusMonitoringMiddleware(statusCounters)
+	consistency := middleware.NewConsistencyMiddleware()
 
 	grpcServer = grpc.NewServer(
-		grpc.ChainUnaryInterceptor(tracing.UnaryIntercept, statusMonitoring.UnaryIntercept),
+		grpc.ChainUnaryInterceptor(tracing.UnaryIntercept, statusMonitoring.UnaryIntercept, consistency.UnaryIntercept),
 	)
 
-	igrpc.RegisterOvaMethodApiServer(grpcServer, app.NewOvaMethodApi(rep, queue))
+	api := app.NewOvaMethodApi(rep, queue)
+	if config.Kafka.MessageKey != "" {
+		keyStrategy, err := iqueue.ParseKeyStrategy(config.Kafka.MessageKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid kafka message key")
+		}
+		api.SetEventKeyStrategy(keyStrategy)
+	}
+
+	topic := config.Kafka.Topic
+	if topic == "" {
+		topic = app.DefaultQueueTopic
+	}
+	router, err := iqueue.NewTopicRouter(topic, config.Kafka.TopicRoutes)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid kafka topic routes")
+	}
+	api.SetTopicRouter(router)
+
+	igrpc.RegisterOvaMethodApiServer(grpcServer, api)
 
 	go func() {
 		log.Info().Str("addr", config.Grpc.Addr).Msg("GRPC server started")
@@ -208,10 +471,17 @@ func shutdown(ctx context.Context) {
 	grpcServer.GracefulStop()
 	log.Info().Msg("GRPC server stopped")
 
-	if err := conn.Close(); err != nil {
-		log.Fatal().Err(err).Msg("failed close db connection")
+	if stopRetry != nil {
+		stopRetry()
+	}
+
+	// queue is closed before the database, so that failed messages still can be stored as dead letters
+	if err := queue.Close(); err != nil {
+		log.Fatal().Err(err).Msg("failed close connect to queue")
 	}
 
+	closeDatabase()
+
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("failed shutdown http server")
 	}
@@ -220,8 +490,145 @@ func shutdown(ctx context.Context) {
 	if err := tracingCloser.Close(); err != nil {
 		log.Fatal().Err(err).Msg("failed close opentracing")
 	}
+}
 
-	if err := queue.Close(); err != nil {
-		log.Fatal().Err(err).Msg("failed close connect to queue")
+func closeDatabase() {
+	if replicas != nil {
+		replicas.Close()
+	}
+	for _, replicaConn := range replicaConns {
+		if err := replicaConn.Close(); err != nil {
+			log.Error().Err(err).Msg("failed close db replica connection")
+		}
+	}
+
+	if err := conn.Close(); err != nil {
+		log.Fatal().Err(err).Msg("failed close db connection")
+	}
+}
+
+// runCommand executes a maintenance command instead of starting the servers.
+// Usage: dead-letters replay [id...] | migrate up|down|status|to <version>
+func runCommand(config *internal.Application, args []string) {
+	switch args[0] {
+	case "dead-letters":
+		replayDeadLetters(config, args[1:])
+	case "migrate":
+		runMigrations(config, args[1:])
+	default:
+		log.Fatal().Str("command", args[0]).Msg("unknown command")
+	}
+}
+
+func newMigrator(config *internal.Application) migrate.Migrator {
+	source, err := migrations.ForDriver(config.Database.Driver)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed load migrations")
+	}
+
+	migrator, err := migrate.New(conn.DB, config.Database.Driver, source)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed load migrations")
+	}
+	return migrator
+}
+
+// autoMigrate applies the pending migrations, the migrator lock makes concurrently started replicas wait for each other.
+func autoMigrate(config *internal.Application) {
+	if !config.Database.AutoMigrate {
+		return
+	}
+
+	migrated, err := newMigrator(config).Up(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed apply migrations")
+	}
+	for _, migration := range migrated {
+		log.Info().Str("migration", migration.Name).Msg("migration applied")
+	}
+}
+
+func runMigrations(config *internal.Application, args []string) {
+	if len(args) == 0 {
+		log.Fatal().Msg("usage: migrate up|down|status|to <version>")
+	}
+
+	connectToDatabase(config)
+
+	ctx := context.Background()
+	migrator := newMigrator(config)
+
+	var (
+		migrated []migrate.Migration
+		err      error
+	)
+	switch args[0] {
+	case "up":
+		migrated, err = migrator.Up(ctx)
+	case "down":
+		migrated, err = migrator.Down(ctx)
+	case "to":
+		if len(args) < 2 {
+			log.Fatal().Msg("usage: migrate to <version>")
+		}
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil {
+			log.Fatal().Err(parseErr).Str("version", args[1]).Msg("invalid migration version")
+		}
+		migrated, err = migrator.To(ctx, version)
+	case "status":
+		var statuses []migrate.Status
+		statuses, err = migrator.Status(ctx)
+		for _, status := range statuses {
+			event := log.Info().Str("migration", status.Name).Bool("applied", status.Applied)
+			if status.Applied {
+				event = event.Time("appliedAt", status.AppliedAt)
+			}
+			event.Msg("migration status")
+		}
+	default:
+		log.Fatal().Str("command", args[0]).Msg("unknown migrate command")
+	}
+
+	for _, migration := range migrated {
+		log.Info().Str("migration", migration.Name).Str("command", args[0]).Msg("migration done")
+	}
+
+	closeDatabase()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed migrate database")
+	}
+}
+
+func replayDeadLetters(config *internal.Application, args []string) {
+	if len(args) == 0 || args[0] != "replay" {
+		log.Fatal().Msg("usage: dead-letters replay [id...]")
+	}
+
+	ids := make([]uint64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			log.Fatal().Err(err).Str("id", arg).Msg("invalid dead letter id")
+		}
+		ids = append(ids, id)
+	}
+
+	config.DeadLetter.Enabled = true
+
+	connectToDatabase(config)
+	connectToQueue(config)
+	initDeadLetters(config)
+
+	resent, err := deadLetters.Replay(context.Background(), ids)
+	log.Info().Int("resent", resent).Msg("dead letters replayed")
+
+	if closeErr := queue.Close(); closeErr != nil {
+		log.Error().Err(closeErr).Msg("failed close connect to queue")
+	}
+	closeDatabase()
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed replay dead letters")
 	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"ova-method-api/internal"
+)
+
+func TestMakeSaramaConfig(t *testing.T) {
+	zero, five := 0, 5
+
+	testCases := []struct {
+		configure   func(config *internal.Application)
+		check       func(config *sarama.Config) bool
+		expectedErr bool
+	}{
+		{
+			configure: func(config *internal.Application) {},
+			check: func(config *sarama.Config) bool {
+				return config.Version == sarama.V0_11_0_0 &&
+					config.Producer.RequiredAcks == sarama.WaitForLocal &&
+					config.Producer.Compression == sarama.CompressionNone &&
+					config.Producer.Retry.Max == 3 &&
+					config.Producer.Return.Successes
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Version = "2.8.0"
+				config.Kafka.ClientId = "ova-method-api"
+				config.Kafka.Acks = "all"
+				config.Kafka.Compression = "zstd"
+				config.Kafka.Retries = &five
+				config.Kafka.RetryBackoffMs = 250
+			},
+			check: func(config *sarama.Config) bool {
+				return config.Version == sarama.V2_8_0_0 &&
+					config.ClientID == "ova-method-api" &&
+					config.Producer.RequiredAcks == sarama.WaitForAll &&
+					config.Producer.Compression == sarama.CompressionZSTD &&
+					config.Producer.Retry.Max == 5 &&
+					config.Producer.Retry.Backoff == 250*time.Millisecond
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Retries = &zero
+			},
+			check: func(config *sarama.Config) bool {
+				return config.Producer.Retry.Max == 0
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Acks = "none"
+				config.Kafka.Idempotent = true
+			},
+			check: func(config *sarama.Config) bool {
+				return config.Producer.Idempotent &&
+					config.Producer.RequiredAcks == sarama.WaitForAll &&
+					config.Net.MaxOpenRequests == 1
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Async = true
+				config.Kafka.ChannelBufferSize = 64
+				config.Kafka.FlushFrequencyMs = 100
+				config.Kafka.FlushMessages = 10
+			},
+			check: func(config *sarama.Config) bool {
+				return config.ChannelBufferSize == 64 &&
+					config.Producer.Flush.Frequency == 100*time.Millisecond &&
+					config.Producer.Flush.Messages == 10
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Sasl.Enabled = true
+				config.Kafka.Sasl.Mechanism = "scram-sha-512"
+				config.Kafka.Sasl.User = "user"
+				config.Kafka.Sasl.Pass = "pass"
+			},
+			check: func(config *sarama.Config) bool {
+				return config.Net.SASL.Enable &&
+					config.Net.SASL.Mechanism == sarama.SASLTypeSCRAMSHA512 &&
+					config.Net.SASL.SCRAMClientGeneratorFunc != nil
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Tls.Enabled = true
+				config.Kafka.Tls.InsecureSkipVerify = true
+			},
+			check: func(config *sarama.Config) bool {
+				return config.Net.TLS.Enable && config.Net.TLS.Config.InsecureSkipVerify
+			},
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Version = "0.1"
+			},
+			expectedErr: true,
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Acks = "some"
+			},
+			expectedErr: true,
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Compression = "brotli"
+			},
+			expectedErr: true,
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Tls.Enabled = true
+				config.Kafka.Tls.CaFile = "/not/existing/ca.pem"
+			},
+			expectedErr: true,
+		},
+		{
+			configure: func(config *internal.Application) {
+				config.Kafka.Sasl.Enabled = true
+				config.Kafka.Sasl.Mechanism = "GSSAPI"
+			},
+			expectedErr: true,
+		},
+		{
+			// the idempotent producer requires retries
+			configure: func(config *internal.Application) {
+				config.Kafka.Idempotent = true
+				config.Kafka.Retries = &zero
+			},
+			expectedErr: true,
+		},
+	}
+
+	for index, testCase := range testCases {
+		config := &internal.Application{}
+		testCase.configure(config)
+
+		result, err := makeSaramaConfig(config)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+		if err == nil && !testCase.check(result) {
+			t.Errorf("failed testCase[%d], unexpected config %+v", index, result.Producer)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"ova-method-api/internal/repo"
+)
+
+// ReadYourWritesHeader is the request metadata which makes reads of the request go to the primary database.
+const ReadYourWritesHeader = "x-read-your-writes"
+
+type consistencyMiddleware struct{}
+
+func NewConsistencyMiddleware() *consistencyMiddleware {
+	return &consistencyMiddleware{}
+}
+
+func (middleware *consistencyMiddleware) UnaryIntercept(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if middleware.requireReadYourWrites(ctx) {
+		ctx = repo.WithReadYourWrites(ctx)
+	}
+
+	return handler(ctx, req)
+}
+
+func (middleware *consistencyMiddleware) requireReadYourWrites(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, value := range md.Get(ReadYourWritesHeader) {
+		if value == "true" || value == "1" {
+			return true
+		}
+	}
+	return false
+}
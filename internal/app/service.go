@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	tracer "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -11,7 +12,7 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
-	"ova-method-api/internal"
+	"ova-method-api/internal/collection"
 	"ova-method-api/internal/model"
 	iqueue "ova-method-api/internal/queue"
 	"ova-method-api/internal/repo"
@@ -24,34 +25,58 @@ var (
 
 	notFoundGrpcErr = status.Errorf(codes.NotFound, "not found")
 	internalGrpcErr = status.Errorf(codes.Internal, "failed to process request")
+	timeoutGrpcErr  = status.Errorf(codes.DeadlineExceeded, "request timed out")
 )
 
 const (
 	chunkSizeToSave = 2
+
+	// DefaultQueueTopic receives the events when no topic is configured.
+	DefaultQueueTopic = "ova-method"
 )
 
 type СonfigurableOvaMethodApi interface {
 	igrpc.OvaMethodApiServer
 
 	SetChunkSize(chunkSize int)
+	SetEventKeyStrategy(strategy iqueue.KeyStrategy)
+	SetTopicRouter(router iqueue.TopicRouter)
 }
 
 type OvaMethodApi struct {
 	rep       repo.MethodRepo
 	queue     iqueue.Queue
 	chunkSize int
+	keyBy     iqueue.KeyStrategy
+	router    iqueue.TopicRouter
 
 	igrpc.UnimplementedOvaMethodApiServer
 }
 
 func NewOvaMethodApi(rep repo.MethodRepo, queue iqueue.Queue) СonfigurableOvaMethodApi {
-	return &OvaMethodApi{rep: rep, queue: queue, chunkSize: chunkSizeToSave}
+	router, _ := iqueue.NewTopicRouter(DefaultQueueTopic, nil)
+
+	return &OvaMethodApi{
+		rep:       rep,
+		queue:     queue,
+		chunkSize: chunkSizeToSave,
+		keyBy:     iqueue.KeyByMethodId,
+		router:    router,
+	}
 }
 
 func (api *OvaMethodApi) SetChunkSize(chunkSize int) {
 	api.chunkSize = chunkSize
 }
 
+func (api *OvaMethodApi) SetEventKeyStrategy(strategy iqueue.KeyStrategy) {
+	api.keyBy = strategy
+}
+
+func (api *OvaMethodApi) SetTopicRouter(router iqueue.TopicRouter) {
+	api.router = router
+}
+
 func (api *OvaMethodApi) Create(ctx context.Context, req *igrpc.CreateRequest) (*emptypb.Empty, error) {
 	if err := api.validateCreateRequest(req); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
@@ -65,16 +90,25 @@ func (api *OvaMethodApi) Create(ctx context.Context, req *igrpc.CreateRequest) (
 			Err(err).
 			Msg("failed create method")
 
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
 	for _, method := range methods {
-		api.sendEventMsg("created", method.Id)
+		api.sendEventMsg(ctx, iqueue.ActionCreated, method)
 	}
 
 	return &emptypb.Empty{}, nil
 }
 
+// repoGrpcErr converts the repository failure to the grpc error,
+// the timed out and the canceled by the database queries are reported as DeadlineExceeded.
+func repoGrpcErr(err error) error {
+	if repo.IsTimeout(err) {
+		return timeoutGrpcErr
+	}
+	return internalGrpcErr
+}
+
 func (api *OvaMethodApi) validateCreateRequest(req *igrpc.CreateRequest) error {
 	if len(req.Value) == 0 {
 		return EmptyValueValidationErr
@@ -102,7 +136,7 @@ func (api *OvaMethodApi) MultiCreate(ctx context.Context, req *igrpc.MultiCreate
 		models = append(models, api.makeMethodModelFromReq(createReq))
 	}
 
-	chunkedMethods, err := internal.ListOfMethodToChunkSlice(models, api.chunkSize)
+	chunks, err := collection.Chunks(models, api.chunkSize)
 	if err != nil {
 		log.Error().
 			Int("methods len", len(models)).
@@ -115,11 +149,14 @@ func (api *OvaMethodApi) MultiCreate(ctx context.Context, req *igrpc.MultiCreate
 
 	createdMethods := make([]model.Method, 0, len(models))
 	err = api.rep.Transaction(ctx, func(rep repo.MethodRepo) error {
-		for _, chunk := range chunkedMethods {
+		// the transaction is run again after a serialization failure
+		createdMethods = createdMethods[:0]
+
+		for chunk := range chunks {
 			trSpan, _ := tracer.StartSpanFromContext(ctx, "chunk")
 			trSpan.LogKV("chunk-size", len(chunk))
 
-			methods, err := api.rep.Add(ctx, chunk)
+			methods, err := rep.Add(ctx, chunk)
 			if err != nil {
 				trSpan.Finish()
 				return err
@@ -133,11 +170,11 @@ func (api *OvaMethodApi) MultiCreate(ctx context.Context, req *igrpc.MultiCreate
 
 	if err != nil {
 		log.Error().Err(err).Msg("failed multi create")
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
 	for _, method := range createdMethods {
-		api.sendEventMsg("created", method.Id)
+		api.sendEventMsg(ctx, iqueue.ActionCreated, method)
 	}
 
 	return &emptypb.Empty{}, nil
@@ -157,7 +194,7 @@ func (api *OvaMethodApi) Update(ctx context.Context, req *igrpc.UpdateRequest) (
 		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
 	}
 
-	err := api.rep.Update(ctx, req.Id, req.Value)
+	updated, err := api.rep.Update(ctx, req.Id, req.Value)
 	if err == repo.ErrNoRowAffected {
 		return nil, notFoundGrpcErr
 	}
@@ -168,10 +205,10 @@ func (api *OvaMethodApi) Update(ctx context.Context, req *igrpc.UpdateRequest) (
 			Err(err).
 			Msg("failed update method")
 
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
-	api.sendEventMsg("updated", req.Id)
+	api.sendEventMsg(ctx, iqueue.ActionUpdated, *updated)
 
 	return &emptypb.Empty{}, nil
 }
@@ -191,7 +228,7 @@ func (api *OvaMethodApi) Remove(ctx context.Context, req *igrpc.RemoveRequest) (
 		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
 	}
 
-	err := api.rep.Remove(ctx, req.Id)
+	removed, err := api.rep.Remove(ctx, req.Id)
 	if err == repo.ErrNoRowAffected {
 		return nil, notFoundGrpcErr
 	}
@@ -201,10 +238,10 @@ func (api *OvaMethodApi) Remove(ctx context.Context, req *igrpc.RemoveRequest) (
 			Err(err).
 			Msg("failed remove method")
 
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
-	api.sendEventMsg("deleted", req.Id)
+	api.sendEventMsg(ctx, iqueue.ActionDeleted, *removed)
 
 	return &emptypb.Empty{}, nil
 }
@@ -231,7 +268,7 @@ func (api *OvaMethodApi) Describe(ctx context.Context, req *igrpc.DescribeReques
 			Err(err).
 			Msg("failed describe method")
 
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
 	return &igrpc.DescribeResponse{Info: method.String()}, nil
@@ -257,7 +294,7 @@ func (api *OvaMethodApi) List(ctx context.Context, req *igrpc.ListRequest) (*igr
 			Err(err).
 			Msg("failed list method")
 
-		return nil, internalGrpcErr
+		return nil, repoGrpcErr(err)
 	}
 
 	methodList := &igrpc.ListResponse{
@@ -283,12 +320,26 @@ func (api *OvaMethodApi) validateListRequest(req *igrpc.ListRequest) error {
 	return nil
 }
 
-func (api *OvaMethodApi) sendEventMsg(action string, methodId uint64) {
-	err := api.queue.Send("ova-method", iqueue.NewMessage(action, iqueue.Body{
-		"id": methodId,
-	}))
+func (api *OvaMethodApi) sendEventMsg(ctx context.Context, action string, method model.Method) {
+	msg := iqueue.NewMessage(
+		action,
+		iqueue.Body{"id": method.Id},
+		iqueue.WithKey(api.makeEventKey(method)),
+		iqueue.WithTraceContext(ctx),
+	)
+
+	err := api.queue.Send(api.router.Route(action), msg)
 
 	if err != nil {
 		log.Error().Err(err).Msg("failed send message to queue")
 	}
 }
+
+// makeEventKey returns the partitioning key for the method event. The repository returns
+// the owner of the updated and removed methods, so all events of a method get the same key.
+func (api *OvaMethodApi) makeEventKey(method model.Method) string {
+	if api.keyBy == iqueue.KeyByUserId {
+		return strconv.FormatUint(method.UserId, 10)
+	}
+	return strconv.FormatUint(method.Id, 10)
+}
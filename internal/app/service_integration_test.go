@@ -0,0 +1,87 @@
+//go:build integration
+
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	qmock "ova-method-api/internal/queue/mock"
+	"ova-method-api/internal/repo"
+	"ova-method-api/internal/testdb"
+)
+
+func TestMultiCreateIntegration(t *testing.T) {
+	db, err := testdb.Start("../../migrations")
+	if err != nil {
+		t.Fatalf("failed start test database: %v", err)
+	}
+	defer db.Close()
+
+	countMethods := func(t *testing.T) int {
+		var count int
+		if err := db.Get(&count, "SELECT count(*) FROM methods"); err != nil {
+			t.Fatalf("failed count methods: %v", err)
+		}
+		return count
+	}
+
+	t.Run("all chunks are saved", func(t *testing.T) {
+		if err := db.Truncate("methods"); err != nil {
+			t.Fatalf("failed truncate: %v", err)
+		}
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		queue := qmock.NewMockQueue(ctrl)
+		queue.EXPECT().Send(defaultTopic, gomock.Any()).Return(nil).Times(3)
+
+		api := NewOvaMethodApi(repo.NewMethodRepo(db.DB), queue)
+		api.SetChunkSize(2)
+
+		_, err := api.MultiCreate(context.Background(), makeMultiCreateRequest(
+			makeCreateReq(1, "first"),
+			makeCreateReq(1, "second"),
+			makeCreateReq(2, "third"),
+		))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if count := countMethods(t); count != 3 {
+			t.Errorf("expected 3 methods, got %d", count)
+		}
+	})
+
+	t.Run("failed chunk rolls back the previous ones", func(t *testing.T) {
+		if err := db.Truncate("methods"); err != nil {
+			t.Fatalf("failed truncate: %v", err)
+		}
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// no events are expected for the rolled back methods
+		queue := qmock.NewMockQueue(ctrl)
+
+		api := NewOvaMethodApi(repo.NewMethodRepo(db.DB), queue)
+		api.SetChunkSize(1)
+
+		_, err := api.MultiCreate(context.Background(), makeMultiCreateRequest(
+			makeCreateReq(1, "first"),
+			// exceeds varchar(255) of the value column
+			makeCreateReq(1, strings.Repeat("x", 256)),
+		))
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("expected internal error, got %v", err)
+		}
+		if count := countMethods(t); count != 0 {
+			t.Errorf("expected no methods after rollback, got %d", count)
+		}
+	})
+}
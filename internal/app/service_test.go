@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
@@ -45,7 +47,7 @@ var (
 	queue = qmock.NewMockQueue(ctrl)
 
 	method  = model.Method{UserId: 1, Value: "hello"}
-	txProxy = func(ctx context.Context, fn func(rep repo.MethodRepo) error) error {
+	txProxy = func(ctx context.Context, fn func(rep repo.MethodRepo) error, opts ...repo.TxOption) error {
 		return fn(rep)
 	}
 
@@ -65,13 +67,13 @@ var _ = BeforeSuite(func() {
 	service = NewOvaMethodApi(rep, queue)
 	proto.RegisterOvaMethodApiServer(server, service)
 
-	go func() {
-		listen, err := net.Listen("tcp", listenAddr)
-		if err != nil {
-			GinkgoT().Fatalf("failed create net listen: %v", err)
-		}
+	listen, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		GinkgoT().Fatalf("failed create net listen: %v", err)
+	}
 
-		if err = server.Serve(listen); err != nil {
+	go func() {
+		if err := server.Serve(listen); err != nil {
 			GinkgoT().Fatalf("failed start grpc server: %v", err)
 		}
 	}()
@@ -113,6 +115,12 @@ var _ = Describe("OvaMethodApi", func() {
 				rep.EXPECT().Add(gomock.Any(), []model.Method{{UserId: 1, Value: "1"}}).Return(nil, defaultErr)
 				return nil, codes.Internal
 			}),
+			Entry("rep timeout", makeCreateReq(1, "1"), func() (*emptypb.Empty, codes.Code) {
+				rep.EXPECT().
+					Add(gomock.Any(), []model.Method{{UserId: 1, Value: "1"}}).
+					Return(nil, errors.Wrap(context.DeadlineExceeded, "query"))
+				return nil, codes.DeadlineExceeded
+			}),
 		)
 
 		It("successful", func() {
@@ -126,6 +134,57 @@ var _ = Describe("OvaMethodApi", func() {
 			Expect(err).To(BeNil())
 			Expect(result).Should(BeAssignableToTypeOf(&emptypb.Empty{}))
 		})
+
+		Context("with user id event key", func() {
+			BeforeEach(func() {
+				service.SetEventKeyStrategy(iqueue.KeyByUserId)
+			})
+			AfterEach(func() {
+				service.SetEventKeyStrategy(iqueue.KeyByMethodId)
+			})
+
+			It("successful", func() {
+				rep.EXPECT().
+					Add(gomock.Any(), []model.Method{{UserId: 7, Value: "1"}}).
+					Return([]model.Method{{Id: 1, UserId: 7}}, nil)
+
+				queue.EXPECT().Send(defaultTopic, makeQueueMsg("created", 1, iqueue.WithKey("7"))).Return(nil)
+
+				result, err := client.Create(defaultCtx, makeCreateReq(7, "1"))
+				Expect(err).To(BeNil())
+				Expect(result).Should(BeAssignableToTypeOf(&emptypb.Empty{}))
+			})
+		})
+	})
+
+	Context("with user id event key", func() {
+		BeforeEach(func() {
+			service.SetEventKeyStrategy(iqueue.KeyByUserId)
+		})
+		AfterEach(func() {
+			service.SetEventKeyStrategy(iqueue.KeyByMethodId)
+		})
+
+		It("keys all events of the method by its owner", func() {
+			rep.EXPECT().
+				Add(gomock.Any(), []model.Method{{UserId: 7, Value: "1"}}).
+				Return([]model.Method{{Id: 3, UserId: 7, Value: "1"}}, nil)
+			rep.EXPECT().Update(gomock.Any(), uint64(3), "2").Return(&model.Method{Id: 3, UserId: 7, Value: "2"}, nil)
+			rep.EXPECT().Remove(gomock.Any(), uint64(3)).Return(&model.Method{Id: 3, UserId: 7, Value: "2"}, nil)
+
+			gomock.InOrder(
+				queue.EXPECT().Send(defaultTopic, makeQueueMsg("created", 3, iqueue.WithKey("7"))).Return(nil),
+				queue.EXPECT().Send(defaultTopic, makeQueueMsg("updated", 3, iqueue.WithKey("7"))).Return(nil),
+				queue.EXPECT().Send(defaultTopic, makeQueueMsg("deleted", 3, iqueue.WithKey("7"))).Return(nil),
+			)
+
+			_, err := client.Create(defaultCtx, makeCreateReq(7, "1"))
+			Expect(err).To(BeNil())
+			_, err = client.Update(defaultCtx, makeUpdateReq(3, "2"))
+			Expect(err).To(BeNil())
+			_, err = client.Remove(defaultCtx, makeRemoveReq(3))
+			Expect(err).To(BeNil())
+		})
 	})
 
 	Describe("MultiCreate", func() {
@@ -177,6 +236,24 @@ var _ = Describe("OvaMethodApi", func() {
 			})
 		})
 
+		It("chunks are added by the transactional repository", func() {
+			txRep := mock.NewMockMethodRepo(ctrl)
+
+			rep.EXPECT().
+				Transaction(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, fn func(rep repo.MethodRepo) error, opts ...repo.TxOption) error {
+					return fn(txRep)
+				})
+			txRep.EXPECT().
+				Add(gomock.Any(), []model.Method{{UserId: 1, Value: "1"}}).
+				Return([]model.Method{{Id: 1}}, nil)
+
+			queue.EXPECT().Send(defaultTopic, makeQueueMsg("created", 1)).Return(nil)
+
+			_, err := client.MultiCreate(defaultCtx, makeMultiCreateRequest(makeCreateReq(1, "1")))
+			Expect(err).To(BeNil())
+		})
+
 		It("successful", func() {
 			rep.EXPECT().Transaction(gomock.Any(), gomock.Any()).Do(txProxy).Return(nil)
 			rep.EXPECT().
@@ -208,13 +285,13 @@ var _ = Describe("OvaMethodApi", func() {
 				return nil, codes.InvalidArgument
 			}),
 			Entry("rep error", makeUpdateReq(1, "1"), func() (*emptypb.Empty, codes.Code) {
-				rep.EXPECT().Update(gomock.Any(), uint64(1), "1").Return(defaultErr)
+				rep.EXPECT().Update(gomock.Any(), uint64(1), "1").Return(nil, defaultErr)
 				return nil, codes.Internal
 			}),
 		)
 
 		It("successful", func() {
-			rep.EXPECT().Update(gomock.Any(), uint64(1), "1").Return(nil)
+			rep.EXPECT().Update(gomock.Any(), uint64(1), "1").Return(&model.Method{Id: 1, UserId: 7}, nil)
 			queue.EXPECT().Send(defaultTopic, makeQueueMsg("updated", 1)).Return(nil)
 
 			result, err := client.Update(defaultCtx, makeUpdateReq(1, "1"))
@@ -237,19 +314,39 @@ var _ = Describe("OvaMethodApi", func() {
 				return nil, codes.InvalidArgument
 			}),
 			Entry("rep error", makeRemoveReq(1), func() (*emptypb.Empty, codes.Code) {
-				rep.EXPECT().Remove(gomock.Any(), uint64(1)).Return(defaultErr)
+				rep.EXPECT().Remove(gomock.Any(), uint64(1)).Return(nil, defaultErr)
 				return nil, codes.Internal
 			}),
 		)
 
 		It("successful", func() {
-			rep.EXPECT().Remove(gomock.Any(), uint64(1)).Return(nil)
+			rep.EXPECT().Remove(gomock.Any(), uint64(1)).Return(&model.Method{Id: 1, UserId: 7}, nil)
 			queue.EXPECT().Send(defaultTopic, makeQueueMsg("deleted", 1)).Return(nil)
 
 			result, err := client.Remove(defaultCtx, makeRemoveReq(1))
 			Expect(err).To(BeNil())
 			Expect(result).Should(BeAssignableToTypeOf(&emptypb.Empty{}))
 		})
+
+		It("successful with topic route", func() {
+			router, err := iqueue.NewTopicRouter(defaultTopic, map[string]string{
+				iqueue.ActionDeleted: "ova-method-deleted",
+			})
+			Expect(err).To(BeNil())
+
+			service.SetTopicRouter(router)
+			defer func() {
+				router, _ = iqueue.NewTopicRouter(defaultTopic, nil)
+				service.SetTopicRouter(router)
+			}()
+
+			rep.EXPECT().Remove(gomock.Any(), uint64(1)).Return(&model.Method{Id: 1, UserId: 7}, nil)
+			queue.EXPECT().Send("ova-method-deleted", makeQueueMsg("deleted", 1)).Return(nil)
+
+			result, err := client.Remove(defaultCtx, makeRemoveReq(1))
+			Expect(err).To(BeNil())
+			Expect(result).Should(BeAssignableToTypeOf(&emptypb.Empty{}))
+		})
 	})
 
 	Describe("Describe", func() {
@@ -273,6 +370,10 @@ var _ = Describe("OvaMethodApi", func() {
 				rep.EXPECT().Describe(gomock.Any(), uint64(1)).Return(nil, defaultErr)
 				return nil, codes.Internal
 			}),
+			Entry("rep query canceled", makeDescribeReq(1), func() (*proto.DescribeResponse, codes.Code) {
+				rep.EXPECT().Describe(gomock.Any(), uint64(1)).Return(nil, pgx.PgError{Code: "57014"})
+				return nil, codes.DeadlineExceeded
+			}),
 		)
 
 		It("successful", func() {
@@ -382,8 +483,9 @@ func makeListReq(limit, offset uint64) *proto.ListRequest {
 	}
 }
 
-func makeQueueMsg(action string, id uint64) iqueue.QueueMsg {
+func makeQueueMsg(action string, id uint64, opts ...iqueue.MessageOption) iqueue.QueueMsg {
+	opts = append([]iqueue.MessageOption{iqueue.WithKey(strconv.FormatUint(id, 10))}, opts...)
 	return iqueue.NewMessage(action, iqueue.Body{
 		"id": id,
-	})
+	}, opts...)
 }
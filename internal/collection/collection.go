@@ -0,0 +1,96 @@
+package collection
+
+import (
+	"fmt"
+	"iter"
+)
+
+var (
+	ErrDuplicateKey     = fmt.Errorf("duplicate key")
+	ErrInvalidChunkSize = fmt.Errorf("invalid chunk size")
+)
+
+// Chunks returns a lazy sequence of consecutive chunks of at most size items.
+// Chunks are sub-slices of items, so nothing is copied.
+func Chunks[T any](items []T, size int) (iter.Seq[[]T], error) {
+	if size <= 0 {
+		return nil, ErrInvalidChunkSize
+	}
+
+	return func(yield func([]T) bool) {
+		for from := 0; from < len(items); from += size {
+			to := from + size
+			if to > len(items) {
+				to = len(items)
+			}
+			if !yield(items[from:to:to]) {
+				return
+			}
+		}
+	}, nil
+}
+
+// Chunk splits items into chunks of at most size items.
+func Chunk[T any](items []T, size int) ([][]T, error) {
+	chunks, err := Chunks(items, size)
+	if err != nil {
+		return [][]T{}, err
+	}
+
+	result := make([][]T, 0, (len(items)+size-1)/size)
+	for chunk := range chunks {
+		result = append(result, chunk)
+	}
+
+	return result, nil
+}
+
+// Filter returns items accepted by keep, the order is preserved.
+func Filter[T any](items []T, keep func(item T) bool) []T {
+	result := make([]T, 0, len(items))
+	for _, item := range items {
+		if keep(item) {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// ToMap builds a map of items by the key returned by key, ErrDuplicateKey is returned
+// if two items have the same key.
+func ToMap[K comparable, V any](items []V, key func(item V) K) (map[K]V, error) {
+	result := make(map[K]V, len(items))
+	for _, item := range items {
+		k := key(item)
+		if _, ok := result[k]; ok {
+			return nil, ErrDuplicateKey
+		}
+		result[k] = item
+	}
+
+	return result, nil
+}
+
+// InvertMap swaps keys and values, ErrDuplicateKey is returned if values are not unique.
+func InvertMap[K, V comparable](items map[K]V) (map[V]K, error) {
+	result := make(map[V]K, len(items))
+	for k, v := range items {
+		if _, ok := result[v]; ok {
+			return nil, ErrDuplicateKey
+		}
+		result[v] = k
+	}
+
+	return result, nil
+}
+
+// Set builds a set of values for membership checks, e.g. as a Filter predicate.
+func Set[T comparable](values ...T) map[T]struct{} {
+	result := make(map[T]struct{}, len(values))
+	for _, value := range values {
+		result[value] = struct{}{}
+	}
+
+	return result
+}
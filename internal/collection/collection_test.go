@@ -0,0 +1,178 @@
+package collection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunk(t *testing.T) {
+	testCases := []struct {
+		sequence    []string
+		size        int
+		expectedRes [][]string
+		expectedErr error
+	}{
+		{
+			sequence:    []string{"a"},
+			size:        0,
+			expectedRes: [][]string{},
+			expectedErr: ErrInvalidChunkSize,
+		},
+		{
+			sequence:    nil,
+			size:        2,
+			expectedRes: [][]string{},
+		},
+		{
+			sequence:    []string{"a", "b", "c"},
+			size:        2,
+			expectedRes: [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			sequence:    []string{"a", "b"},
+			size:        5,
+			expectedRes: [][]string{{"a", "b"}},
+		},
+	}
+
+	for index, testCase := range testCases {
+		result, err := Chunk(testCase.sequence, testCase.size)
+		if err != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected '%v' got '%v'", index, testCase.expectedErr, err)
+		}
+		if !reflect.DeepEqual(result, testCase.expectedRes) {
+			t.Errorf("failed testCase[%d], expected '%v' got '%v'", index, testCase.expectedRes, result)
+		}
+	}
+}
+
+func TestChunksStopEarly(t *testing.T) {
+	chunks, err := Chunks([]int{1, 2, 3, 4, 5}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var result [][]int
+	for chunk := range chunks {
+		result = append(result, chunk)
+		if len(result) == 2 {
+			break
+		}
+	}
+
+	if expected := [][]int{{1, 2}, {3, 4}}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected '%v' got '%v'", expected, result)
+	}
+}
+
+func TestChunksDontOverwriteSource(t *testing.T) {
+	source := []int{1, 2, 3}
+	chunks, _ := Chunks(source, 2)
+
+	for chunk := range chunks {
+		_ = append(chunk, 0)
+	}
+
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(source, expected) {
+		t.Errorf("expected '%v' got '%v'", expected, source)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	isEven := func(val int) bool { return val%2 == 0 }
+
+	testCases := []struct {
+		sequence    []int
+		expectedRes []int
+	}{
+		{
+			sequence:    nil,
+			expectedRes: []int{},
+		},
+		{
+			sequence:    []int{1, 3},
+			expectedRes: []int{},
+		},
+		{
+			sequence:    []int{4, 1, 2, 2},
+			expectedRes: []int{4, 2, 2},
+		},
+	}
+
+	for index, testCase := range testCases {
+		result := Filter(testCase.sequence, isEven)
+		if !reflect.DeepEqual(result, testCase.expectedRes) {
+			t.Errorf("failed testCase[%d], expected '%v' got '%v'", index, testCase.expectedRes, result)
+		}
+	}
+}
+
+func TestToMap(t *testing.T) {
+	type user struct {
+		id   int
+		name string
+	}
+	byId := func(u user) int { return u.id }
+
+	testCases := []struct {
+		sequence    []user
+		expectedRes map[int]user
+		expectedErr error
+	}{
+		{
+			sequence:    nil,
+			expectedRes: map[int]user{},
+		},
+		{
+			sequence:    []user{{1, "a"}, {2, "b"}},
+			expectedRes: map[int]user{1: {1, "a"}, 2: {2, "b"}},
+		},
+		{
+			sequence:    []user{{1, "a"}, {1, "b"}},
+			expectedRes: nil,
+			expectedErr: ErrDuplicateKey,
+		},
+	}
+
+	for index, testCase := range testCases {
+		result, err := ToMap(testCase.sequence, byId)
+		if err != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected '%v' got '%v'", index, testCase.expectedErr, err)
+		}
+		if !reflect.DeepEqual(result, testCase.expectedRes) {
+			t.Errorf("failed testCase[%d], expected '%v' got '%v'", index, testCase.expectedRes, result)
+		}
+	}
+}
+
+func TestInvertMap(t *testing.T) {
+	testCases := []struct {
+		sequence    map[string]int
+		expectedRes map[int]string
+		expectedErr error
+	}{
+		{
+			sequence:    nil,
+			expectedRes: map[int]string{},
+		},
+		{
+			sequence:    map[string]int{"a": 1, "b": 2},
+			expectedRes: map[int]string{1: "a", 2: "b"},
+		},
+		{
+			sequence:    map[string]int{"a": 1, "b": 1},
+			expectedRes: nil,
+			expectedErr: ErrDuplicateKey,
+		},
+	}
+
+	for index, testCase := range testCases {
+		result, err := InvertMap(testCase.sequence)
+		if err != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected '%v' got '%v'", index, testCase.expectedErr, err)
+		}
+		if !reflect.DeepEqual(result, testCase.expectedRes) {
+			t.Errorf("failed testCase[%d], expected '%v' got '%v'", index, testCase.expectedRes, result)
+		}
+	}
+}
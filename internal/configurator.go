@@ -3,7 +3,11 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -17,6 +21,7 @@ type Application struct {
 	Http       httpConfig
 	Grpc       grpcConfig
 	Kafka      kafkaConfig
+	DeadLetter deadLetterConfig
 	Database   databaseConfig
 }
 
@@ -63,21 +68,125 @@ type grpcConfig struct {
 }
 
 type kafkaConfig struct {
-	Brokers []string
+	Brokers     []string
+	Topic       string
+	TopicRoutes map[string]string
+	ClientId    string
+	Version     string
+	MessageKey  string
+
+	Acks        string
+	Compression string
+	Idempotent  bool
+	// Retries is optional, a missing value keeps the sarama default and 0 disables the retries
+	Retries        *int
+	RetryBackoffMs int
+
+	Async             bool
+	ChannelBufferSize int
+	FlushFrequencyMs  int
+	FlushMessages     int
+	FlushBytes        int
+
+	Tls  kafkaTlsConfig
+	Sasl kafkaSaslConfig
+}
+
+type kafkaTlsConfig struct {
+	Enabled            bool
+	CaFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+type kafkaSaslConfig struct {
+	Enabled   bool
+	Mechanism string
+	User      string
+	Pass      string
+}
+
+func (kc *kafkaConfig) GetFlushFrequency() time.Duration {
+	return time.Duration(kc.FlushFrequencyMs) * time.Millisecond
+}
+
+func (kc *kafkaConfig) GetRetryBackoff() time.Duration {
+	return time.Duration(kc.RetryBackoffMs) * time.Millisecond
+}
+
+type deadLetterConfig struct {
+	Enabled         bool
+	MaxAttempts     uint
+	BatchSize       uint64
+	RetryIntervalMs int
+	BackoffBaseMs   int
+	BackoffMaxMs    int
+}
+
+// Validate rejects a zero batch size of the enabled handler, which would select no letters to retry or replay.
+func (dc *deadLetterConfig) Validate() error {
+	if dc.Enabled && dc.BatchSize == 0 {
+		return fmt.Errorf("deadLetter.batchSize must be positive")
+	}
+	return nil
+}
+
+func (dc *deadLetterConfig) GetRetryInterval() time.Duration {
+	return time.Duration(dc.RetryIntervalMs) * time.Millisecond
+}
+
+func (dc *deadLetterConfig) GetBackoffBase() time.Duration {
+	return time.Duration(dc.BackoffBaseMs) * time.Millisecond
+}
+
+func (dc *deadLetterConfig) GetBackoffMax() time.Duration {
+	return time.Duration(dc.BackoffMaxMs) * time.Millisecond
 }
 
 type databaseConfig struct {
+	// Driver is pgx for Postgres or sqlite, the sqlite database is stored in the Db file
 	Driver string
-	Host   string
-	Port   string
-	User   string
-	Pass   string
-	Db     string
+
+	// Dsn is a full postgres:// connection url, it replaces the fields below when set.
+	// Only the ${DATABASE_PASS} form of environment variables is expanded, other $ are kept.
+	Dsn string
+
+	Host string
+	Port string
+	User string
+	Pass string
+	Db   string
+
+	SslMode            string
+	SslRootCert        string
+	ApplicationName    string
+	StatementTimeoutMs int
 
 	MaxOpenConns       int
 	MaxIdleConns       int
 	ConnTimeoutMs      int
 	ConnMaxLifetimeSec int
+
+	// ReadTimeoutMs, WriteTimeoutMs and BulkTimeoutMs bound the repository operations of requests without a deadline
+	ReadTimeoutMs  int
+	WriteTimeoutMs int
+	BulkTimeoutMs  int
+
+	// AutoMigrate applies the pending migrations at startup
+	AutoMigrate bool
+
+	// TxMaxAttempts is the number of runs of a transaction failed by a serialization failure or a deadlock
+	TxMaxAttempts uint
+
+	// Replicas serve reads outside of transactions, they share credentials and the database name with the primary
+	Replicas               []databaseReplicaConfig
+	ReplicaCheckIntervalMs int
+}
+
+type databaseReplicaConfig struct {
+	Host string
+	Port string
 }
 
 func (dc *databaseConfig) GetConnTimeout() time.Duration {
@@ -88,22 +197,114 @@ func (dc *databaseConfig) GetConnMaxLifetime() time.Duration {
 	return time.Duration(dc.ConnMaxLifetimeSec) * time.Second
 }
 
-func (dc *databaseConfig) String() string {
+func (dc *databaseConfig) GetReadTimeout() time.Duration {
+	return time.Duration(dc.ReadTimeoutMs) * time.Millisecond
+}
+
+func (dc *databaseConfig) GetWriteTimeout() time.Duration {
+	return time.Duration(dc.WriteTimeoutMs) * time.Millisecond
+}
+
+func (dc *databaseConfig) GetBulkTimeout() time.Duration {
+	return time.Duration(dc.BulkTimeoutMs) * time.Millisecond
+}
+
+func (dc *databaseConfig) GetReplicaCheckInterval() time.Duration {
+	return time.Duration(dc.ReplicaCheckIntervalMs) * time.Millisecond
+}
+
+// ReplicaString returns the connection string of the replica.
+func (dc *databaseConfig) ReplicaString(replica databaseReplicaConfig) (string, error) {
+	if dc.Driver != "pgx" {
+		return "", fmt.Errorf("replicas are not supported by driver %q", dc.Driver)
+	}
+
+	replicaConfig := *dc
+	replicaConfig.Host = replica.Host
+	replicaConfig.Port = replica.Port
+
+	if dc.Dsn == "" {
+		return replicaConfig.String()
+	}
+
+	dsn, err := dc.String()
+	if err != nil {
+		return "", err
+	}
+
+	dsnUrl, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("replica requires url dsn: %w", err)
+	}
+	dsnUrl.Host = net.JoinHostPort(replica.Host, replica.Port)
+
+	return dsnUrl.String(), nil
+}
+
+func (dc *databaseConfig) String() (string, error) {
 	switch dc.Driver {
 	case "pgx":
-		return fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s",
-			dc.User,
-			dc.Pass,
-			dc.Host,
-			dc.Port,
-			dc.Db,
-		)
+		if dc.Dsn != "" {
+			return expandEnv(dc.Dsn), nil
+		}
+
+		return dc.postgresUrl().String(), nil
+	case "sqlite":
+		if dc.Dsn != "" {
+			return expandEnv(dc.Dsn), nil
+		}
+
+		return dc.sqliteDsn(), nil
 	default:
-		panic("driver not supported")
+		return "", fmt.Errorf("driver %q not supported", dc.Driver)
+	}
+}
+
+// sqliteDsn opens the Db file, writers wait for the file lock instead of failing with SQLITE_BUSY.
+func (dc *databaseConfig) sqliteDsn() string {
+	query := url.Values{}
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Set("_time_format", "sqlite")
+	query.Set("_txlock", "immediate")
+
+	return "file:" + dc.Db + "?" + query.Encode()
+}
+
+func (dc *databaseConfig) postgresUrl() *url.URL {
+	query := url.Values{}
+	if dc.SslMode != "" {
+		query.Set("sslmode", dc.SslMode)
+	}
+	if dc.SslRootCert != "" {
+		query.Set("sslrootcert", dc.SslRootCert)
+	}
+	if dc.ApplicationName != "" {
+		query.Set("application_name", dc.ApplicationName)
+	}
+	if dc.StatementTimeoutMs > 0 {
+		query.Set("statement_timeout", strconv.Itoa(dc.StatementTimeoutMs))
+	}
+
+	return &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dc.User, dc.Pass),
+		Host:     net.JoinHostPort(dc.Host, dc.Port),
+		Path:     "/" + dc.Db,
+		RawQuery: query.Encode(),
 	}
 }
 
+var envRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces only the ${VAR} references, so a literal $ of a password is kept as is.
+func expandEnv(s string) string {
+	return envRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
 func LoadConfig(projectDir string) *Application {
 	readConfig := func(app interface{}, path string) (err error) {
 		f, err := os.Open(path)
@@ -125,5 +326,9 @@ func LoadConfig(projectDir string) *Application {
 		panic(err)
 	}
 
+	if err = app.DeadLetter.Validate(); err != nil {
+		panic(err)
+	}
+
 	return app
 }
@@ -0,0 +1,186 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"ova-method-api/internal/model"
+	iqueue "ova-method-api/internal/queue"
+	"ova-method-api/internal/repo"
+)
+
+type Config struct {
+	MaxAttempts uint
+	BatchSize   uint64
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+type Metrics struct {
+	Stored prometheus.Counter
+	Resent prometheus.Counter
+	Failed prometheus.Counter
+}
+
+// Handler persists messages which failed to be published and sends them again later.
+type Handler interface {
+	Store(ctx context.Context, topic string, msg iqueue.QueueMsg, cause error) error
+	// RetryDue resends letters whose backoff has expired and returns the number of resent letters.
+	RetryDue(ctx context.Context) (int, error)
+	// Replay resends the given letters (or every stored letter when ids are empty)
+	// ignoring the retry schedule and the attempts limit.
+	Replay(ctx context.Context, ids []uint64) (int, error)
+}
+
+type handler struct {
+	queue   iqueue.Queue
+	rep     repo.DeadLetterRepo
+	config  Config
+	metrics Metrics
+	now     func() time.Time
+}
+
+func New(queue iqueue.Queue, rep repo.DeadLetterRepo, config Config, metrics Metrics) Handler {
+	return &handler{queue: queue, rep: rep, config: config, metrics: metrics, now: time.Now}
+}
+
+func (h *handler) Store(ctx context.Context, topic string, msg iqueue.QueueMsg, cause error) error {
+	payload, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+
+	headers, err := json.Marshal(msg.Headers())
+	if err != nil {
+		return err
+	}
+
+	attempts := uint(1)
+	if letterMsg, ok := msg.(*letterMessage); ok {
+		attempts = letterMsg.letter.Attempts + 1
+	}
+
+	err = h.rep.Add(ctx, model.DeadLetter{
+		Topic:         topic,
+		Key:           msg.Key(),
+		Headers:       string(headers),
+		Payload:       payload,
+		Error:         cause.Error(),
+		Attempts:      attempts,
+		NextAttemptAt: h.now().Add(h.backoff(attempts)),
+	})
+	if err != nil {
+		return err
+	}
+
+	h.metrics.Stored.Inc()
+	return nil
+}
+
+func (h *handler) RetryDue(ctx context.Context) (int, error) {
+	letters, err := h.rep.ListDue(ctx, h.now(), h.config.MaxAttempts, h.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return h.resend(ctx, letters)
+}
+
+func (h *handler) Replay(ctx context.Context, ids []uint64) (int, error) {
+	if len(ids) > 0 {
+		letters, err := h.rep.ListByIds(ctx, ids)
+		if err != nil {
+			return 0, err
+		}
+		return h.resend(ctx, letters)
+	}
+
+	// the letters are paged by id, so the rescheduled ones are not listed again
+	var lastId uint64
+	resent := 0
+	for {
+		letters, err := h.rep.ListAfter(ctx, lastId, h.config.BatchSize)
+		if err != nil {
+			return resent, err
+		}
+		if len(letters) == 0 {
+			return resent, nil
+		}
+		lastId = letters[len(letters)-1].Id
+
+		count, err := h.resend(ctx, letters)
+		resent += count
+		if err != nil {
+			return resent, err
+		}
+	}
+}
+
+func (h *handler) resend(ctx context.Context, letters []model.DeadLetter) (int, error) {
+	resent := 0
+	for _, letter := range letters {
+		msg, err := newLetterMessage(letter)
+		if err != nil {
+			return resent, err
+		}
+
+		if sendErr := h.queue.Send(letter.Topic, msg); sendErr != nil {
+			h.metrics.Failed.Inc()
+
+			attempts := letter.Attempts + 1
+			err = h.rep.Reschedule(ctx, letter.Id, attempts, h.now().Add(h.backoff(attempts)), sendErr.Error())
+			if err != nil {
+				return resent, err
+			}
+
+			log.Warn().
+				Uint64("id", letter.Id).
+				Uint("attempts", attempts).
+				Err(sendErr).
+				Msg("failed resend dead letter")
+
+			continue
+		}
+
+		if err = h.rep.Remove(ctx, letter.Id); err != nil {
+			return resent, err
+		}
+
+		h.metrics.Resent.Inc()
+		resent++
+	}
+
+	return resent, nil
+}
+
+func (h *handler) backoff(attempts uint) time.Duration {
+	delay := h.config.BackoffBase
+	for i := uint(1); i < attempts && delay < h.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > h.config.BackoffMax {
+		delay = h.config.BackoffMax
+	}
+	return delay
+}
+
+// RunRetry resends due letters every interval until ctx is done.
+func RunRetry(ctx context.Context, h Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := h.RetryDue(ctx); err != nil {
+				log.Error().Err(err).Msg("failed retry dead letters")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
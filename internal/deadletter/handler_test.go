@@ -0,0 +1,156 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"ova-method-api/internal/model"
+	iqueue "ova-method-api/internal/queue"
+	qmock "ova-method-api/internal/queue/mock"
+	"ova-method-api/internal/repo/mock"
+)
+
+func TestDeadLetter(t *testing.T) {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: ioutil.Discard})
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DeadLetter suites")
+}
+
+var _ = Describe("Handler", func() {
+	var (
+		ctrl  *gomock.Controller
+		rep   *mock.MockDeadLetterRepo
+		queue *qmock.MockQueue
+		h     *handler
+
+		now        = time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+		defaultCtx = context.Background()
+		sendErr    = fmt.Errorf("send error")
+		msg        = iqueue.NewMessage("created", iqueue.Body{"id": 1}, iqueue.WithKey("1"))
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		rep = mock.NewMockDeadLetterRepo(ctrl)
+		queue = qmock.NewMockQueue(ctrl)
+
+		h = New(queue, rep, Config{
+			MaxAttempts: 3,
+			BatchSize:   10,
+			BackoffBase: time.Second,
+			BackoffMax:  3 * time.Second,
+		}, Metrics{
+			Stored: prometheus.NewCounter(prometheus.CounterOpts{Name: "stored"}),
+			Resent: prometheus.NewCounter(prometheus.CounterOpts{Name: "resent"}),
+			Failed: prometheus.NewCounter(prometheus.CounterOpts{Name: "failed"}),
+		}).(*handler)
+		h.now = func() time.Time { return now }
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("store failed message", func() {
+		payload, _ := msg.Encode()
+
+		rep.EXPECT().Add(defaultCtx, model.DeadLetter{
+			Topic:         "ova-method",
+			Key:           "1",
+			Headers:       `{"action":"created","content-type":"application/json"}`,
+			Payload:       payload,
+			Error:         sendErr.Error(),
+			Attempts:      1,
+			NextAttemptAt: now.Add(time.Second),
+		}).Return(nil)
+
+		Expect(h.Store(defaultCtx, "ova-method", msg, sendErr)).To(BeNil())
+	})
+
+	It("resend due letters", func() {
+		letters := []model.DeadLetter{
+			{Id: 1, Topic: "ova-method", Payload: []byte("1"), Attempts: 1},
+			{Id: 2, Topic: "ova-method", Payload: []byte("2"), Attempts: 2},
+		}
+
+		rep.EXPECT().ListDue(defaultCtx, now, uint(3), uint64(10)).Return(letters, nil)
+		queue.EXPECT().Send("ova-method", gomock.Any()).Return(nil)
+		rep.EXPECT().Remove(defaultCtx, uint64(1)).Return(nil)
+		queue.EXPECT().Send("ova-method", gomock.Any()).Return(sendErr)
+		rep.EXPECT().Reschedule(defaultCtx, uint64(2), uint(3), now.Add(3*time.Second), sendErr.Error()).Return(nil)
+
+		resent, err := h.RetryDue(defaultCtx)
+		Expect(err).To(BeNil())
+		Expect(resent).To(Equal(1))
+	})
+
+	It("replay selected letters", func() {
+		rep.EXPECT().ListByIds(defaultCtx, []uint64{5}).Return([]model.DeadLetter{
+			{Id: 5, Topic: "ova-method", Payload: []byte("5"), Attempts: 10},
+		}, nil)
+		queue.EXPECT().Send("ova-method", gomock.Any()).Return(nil)
+		rep.EXPECT().Remove(defaultCtx, uint64(5)).Return(nil)
+
+		resent, err := h.Replay(defaultCtx, []uint64{5})
+		Expect(err).To(BeNil())
+		Expect(resent).To(Equal(1))
+	})
+
+	It("replay every stored letter page by page", func() {
+		h.config.BatchSize = 2
+		letters := []model.DeadLetter{
+			{Id: 1, Topic: "ova-method", Payload: []byte("1"), Attempts: 1},
+			{Id: 2, Topic: "ova-method", Payload: []byte("2"), Attempts: 1},
+			{Id: 4, Topic: "ova-method", Payload: []byte("4"), Attempts: 5},
+			{Id: 7, Topic: "ova-method", Payload: []byte("7"), Attempts: 1},
+			{Id: 9, Topic: "ova-method", Payload: []byte("9"), Attempts: 2},
+		}
+
+		// the failed letters are rescheduled, but the next page starts after the last listed id
+		gomock.InOrder(
+			rep.EXPECT().ListAfter(defaultCtx, uint64(0), uint64(2)).Return(letters[:2], nil),
+			queue.EXPECT().Send("ova-method", gomock.Any()).Return(nil),
+			rep.EXPECT().Remove(defaultCtx, uint64(1)).Return(nil),
+			queue.EXPECT().Send("ova-method", gomock.Any()).Return(sendErr),
+			rep.EXPECT().Reschedule(defaultCtx, uint64(2), uint(2), now.Add(2*time.Second), sendErr.Error()).Return(nil),
+			rep.EXPECT().ListAfter(defaultCtx, uint64(2), uint64(2)).Return(letters[2:4], nil),
+			queue.EXPECT().Send("ova-method", gomock.Any()).Return(sendErr),
+			rep.EXPECT().Reschedule(defaultCtx, uint64(4), uint(6), now.Add(3*time.Second), sendErr.Error()).Return(nil),
+			queue.EXPECT().Send("ova-method", gomock.Any()).Return(nil),
+			rep.EXPECT().Remove(defaultCtx, uint64(7)).Return(nil),
+			rep.EXPECT().ListAfter(defaultCtx, uint64(7), uint64(2)).Return(letters[4:], nil),
+			queue.EXPECT().Send("ova-method", gomock.Any()).Return(nil),
+			rep.EXPECT().Remove(defaultCtx, uint64(9)).Return(nil),
+			rep.EXPECT().ListAfter(defaultCtx, uint64(9), uint64(2)).Return(nil, nil),
+		)
+
+		resent, err := h.Replay(defaultCtx, nil)
+		Expect(err).To(BeNil())
+		Expect(resent).To(Equal(3))
+	})
+
+	It("replay stops on empty page", func() {
+		rep.EXPECT().ListAfter(defaultCtx, uint64(0), uint64(10)).Return(nil, nil)
+
+		resent, err := h.Replay(defaultCtx, nil)
+		Expect(err).To(BeNil())
+		Expect(resent).To(Equal(0))
+	})
+
+	It("store message after failed send", func() {
+		queue.EXPECT().Send("ova-method", msg).Return(sendErr)
+		rep.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+		Expect(NewQueue(queue, h).Send("ova-method", msg)).To(BeNil())
+	})
+})
@@ -0,0 +1,37 @@
+package deadletter
+
+import (
+	"encoding/json"
+
+	"ova-method-api/internal/model"
+	iqueue "ova-method-api/internal/queue"
+)
+
+// letterMessage resends the stored payload as is and keeps track of previous attempts.
+type letterMessage struct {
+	letter  model.DeadLetter
+	headers iqueue.Headers
+}
+
+func newLetterMessage(letter model.DeadLetter) (*letterMessage, error) {
+	headers := iqueue.Headers{}
+	if letter.Headers != "" {
+		if err := json.Unmarshal([]byte(letter.Headers), &headers); err != nil {
+			return nil, err
+		}
+	}
+
+	return &letterMessage{letter: letter, headers: headers}, nil
+}
+
+func (m *letterMessage) Key() string {
+	return m.letter.Key
+}
+
+func (m *letterMessage) Headers() iqueue.Headers {
+	return m.headers
+}
+
+func (m *letterMessage) Encode() ([]byte, error) {
+	return m.letter.Payload, nil
+}
@@ -0,0 +1,34 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	iqueue "ova-method-api/internal/queue"
+)
+
+type deadLetterQueue struct {
+	iqueue.Queue
+
+	handler Handler
+}
+
+// NewQueue decorates the queue so that messages failed to be sent are stored by the handler.
+func NewQueue(queue iqueue.Queue, handler Handler) iqueue.Queue {
+	return &deadLetterQueue{Queue: queue, handler: handler}
+}
+
+func (q *deadLetterQueue) Send(queueName string, msg iqueue.QueueMsg) error {
+	sendErr := q.Queue.Send(queueName, msg)
+	if sendErr == nil {
+		return nil
+	}
+
+	if err := q.handler.Store(context.Background(), queueName, msg, sendErr); err != nil {
+		log.Error().Err(err).Str("topic", queueName).Msg("failed store dead letter")
+		return sendErr
+	}
+
+	return nil
+}
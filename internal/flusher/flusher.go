@@ -2,43 +2,212 @@ package flusher
 
 import (
 	"context"
-	"log"
+	"iter"
+	"sync"
+	"time"
 
-	"ova-method-api/internal"
+	"github.com/rs/zerolog/log"
+
+	"ova-method-api/internal/collection"
 	"ova-method-api/internal/model"
+	"ova-method-api/internal/monitoring"
 	"ova-method-api/internal/repo"
 )
 
+// Failure is an item which was not saved with the cause of the failure.
+type Failure struct {
+	Item model.Method
+	Err  error
+}
+
+type Result struct {
+	// Saved items with the ids assigned by the repository
+	Saved  []model.Method
+	Failed []Failure
+}
+
+func (r *Result) merge(other Result) {
+	r.Saved = append(r.Saved, other.Saved...)
+	r.Failed = append(r.Failed, other.Failed...)
+}
+
 type Flusher interface {
-	Flush(ctx context.Context, items []model.Method) []model.Method
+	Flush(ctx context.Context, items []model.Method) Result
+}
+
+type Option func(f *flusher)
+
+// WithWorkers sets the number of chunks flushed concurrently. The number is limited
+// by maxOpenConns of the database pool, so the workers don't wait for each other's connections;
+// zero maxOpenConns means an unlimited pool.
+func WithWorkers(workers, maxOpenConns int) Option {
+	return func(f *flusher) {
+		if maxOpenConns > 0 && workers > maxOpenConns {
+			workers = maxOpenConns
+		}
+		if workers > 0 {
+			f.workers = workers
+		}
+	}
+}
+
+// WithBulkThreshold makes chunks of at least threshold items be inserted by MethodRepo.BulkAdd.
+func WithBulkThreshold(threshold int) Option {
+	return func(f *flusher) {
+		f.bulkThreshold = threshold
+	}
+}
+
+func WithMetrics(metrics monitoring.FlusherMetrics) Option {
+	return func(f *flusher) {
+		f.metrics = metrics
+	}
 }
 
 type flusher struct {
-	chunkSize  int
-	methodRepo repo.MethodRepo
+	chunkSize     int
+	workers       int
+	bulkThreshold int
+	methodRepo    repo.MethodRepo
+	metrics       monitoring.FlusherMetrics
 }
 
-func New(chunkSize int, methodRepo repo.MethodRepo) Flusher {
-	return &flusher{
+func New(chunkSize int, methodRepo repo.MethodRepo, opts ...Option) Flusher {
+	f := &flusher{
 		chunkSize:  chunkSize,
+		workers:    1,
 		methodRepo: methodRepo,
+		metrics:    monitoring.NewFlusherMetrics(nil),
 	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
 }
 
-func (f *flusher) Flush(ctx context.Context, items []model.Method) []model.Method {
-	chunkedItems, err := internal.ListOfMethodToChunkSlice(items, f.chunkSize)
+// Flush saves items by chunks. Chunks which were not started before ctx is done
+// are reported as failed with the context error. Results keep the order of the chunks.
+func (f *flusher) Flush(ctx context.Context, items []model.Method) Result {
+	chunks, err := collection.Chunks(items, f.chunkSize)
 	if err != nil {
-		log.Println(err)
-		return items
+		log.Error().Err(err).Int("chunk size", f.chunkSize).Msg("failed split to chunk")
+		f.metrics.Failed.Add(float64(len(items)))
+		return Result{Failed: makeFailures(items, err)}
+	}
+
+	var result Result
+	if f.workers == 1 || len(items) <= f.chunkSize {
+		for chunk := range chunks {
+			result.merge(f.flushChunk(ctx, chunk))
+		}
+	} else {
+		for _, chunkResult := range f.flushConcurrently(ctx, chunks, (len(items)+f.chunkSize-1)/f.chunkSize) {
+			result.merge(chunkResult)
+		}
+	}
+
+	f.metrics.Saved.Add(float64(len(result.Saved)))
+	f.metrics.Failed.Add(float64(len(result.Failed)))
+
+	return result
+}
+
+// flushConcurrently returns results in the order of the chunks.
+func (f *flusher) flushConcurrently(ctx context.Context, chunks iter.Seq[[]model.Method], chunkCount int) []Result {
+	type job struct {
+		index int
+		chunk []model.Method
+	}
+
+	workers := f.workers
+	if workers > chunkCount {
+		workers = chunkCount
+	}
+
+	results := make([]Result, chunkCount)
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j.index] = f.flushChunk(ctx, j.chunk)
+			}
+		}()
+	}
+
+	index := 0
+	for chunk := range chunks {
+		jobs <- job{index: index, chunk: chunk}
+		index++
+	}
+	close(jobs)
+
+	wg.Wait()
+	return results
+}
+
+func (f *flusher) flushChunk(ctx context.Context, chunk []model.Method) Result {
+	var result Result
+
+	if err := ctx.Err(); err != nil {
+		result.Failed = makeFailures(chunk, err)
+		return result
+	}
+
+	startedAt := time.Now()
+	saved, err := f.addChunk(ctx, chunk)
+	f.metrics.ChunkDuration.Observe(time.Since(startedAt).Seconds())
+	if err == nil {
+		result.Saved = saved
+		return result
+	}
+
+	log.Error().Err(err).Int("chunk len", len(chunk)).Msg("failed flush chunk")
+
+	// a transient error affects the whole chunk, a permanent one is caused by some of the rows
+	if len(chunk) == 1 || repo.IsTransient(err) {
+		result.Failed = makeFailures(chunk, err)
+		return result
 	}
 
-	var result []model.Method
-	for _, chunk := range chunkedItems {
-		if _, err = f.methodRepo.Add(ctx, chunk); err != nil {
-			log.Println(err)
-			result = append(result, chunk...)
+	f.flushByRow(ctx, chunk, &result)
+	return result
+}
+
+func (f *flusher) addChunk(ctx context.Context, chunk []model.Method) ([]model.Method, error) {
+	if f.bulkThreshold > 0 && len(chunk) >= f.bulkThreshold {
+		return f.methodRepo.BulkAdd(ctx, chunk)
+	}
+	return f.methodRepo.Add(ctx, chunk)
+}
+
+// flushByRow saves items of the failed chunk one by one to isolate the poison record.
+func (f *flusher) flushByRow(ctx context.Context, chunk []model.Method, result *Result) {
+	f.metrics.Split.Inc()
+
+	for _, item := range chunk {
+		saved, err := f.methodRepo.Add(ctx, []model.Method{item})
+		if err != nil {
+			result.Failed = append(result.Failed, Failure{Item: item, Err: err})
+			continue
 		}
+		result.Saved = append(result.Saved, saved...)
 	}
+}
 
+func makeFailures(items []model.Method, err error) []Failure {
+	if len(items) == 0 {
+		return nil
+	}
+
+	result := make([]Failure, 0, len(items))
+	for _, item := range items {
+		result = append(result, Failure{Item: item, Err: err})
+	}
 	return result
 }
@@ -2,15 +2,20 @@ package flusher
 
 import (
 	"context"
+	"database/sql/driver"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"ova-method-api/internal"
 	"ova-method-api/internal/model"
+	"ova-method-api/internal/monitoring"
 	"ova-method-api/internal/repo/mock"
 )
 
@@ -33,32 +38,116 @@ var _ = Describe("Flusher", func() {
 		sequence := []model.Method{{UserId: 1}}
 
 		DescribeTable("not flushed",
-			func(chunkSize int, toFlush []model.Method, expected []model.Method) {
+			func(chunkSize int, toFlush []model.Method, expected Result) {
 				result := New(chunkSize, rep).Flush(defaultCtx, toFlush)
 				Expect(result).To(Equal(expected))
 			},
-			Entry("chunk 0", 0, sequence, sequence),
-			Entry("chunk -1", -1, sequence, sequence),
-			Entry("nothing to flush", 1, nil, nil),
+			Entry("chunk 0", 0, sequence, Result{Failed: makeFailures(sequence, internal.InvalidChunkSizeErr)}),
+			Entry("chunk -1", -1, sequence, Result{Failed: makeFailures(sequence, internal.InvalidChunkSizeErr)}),
+			Entry("nothing to flush", 1, nil, Result{}),
 		)
 
 		DescribeTable("repository add equal",
-			func(toFlush []model.Method, expected []model.Method, err error) {
-				rep.EXPECT().Add(defaultCtx, toFlush).Return(nil, err)
+			func(toFlush []model.Method, saved []model.Method, err error, expected Result) {
+				rep.EXPECT().Add(defaultCtx, toFlush).Return(saved, err)
 				result := New(len(toFlush), rep).Flush(defaultCtx, toFlush)
 				Expect(result).To(Equal(expected))
 			},
-			Entry("add error", sequence, sequence, flushErr),
-			Entry("add success", sequence, nil, nil),
+			Entry("add error", sequence, nil, flushErr, Result{Failed: makeFailures(sequence, flushErr)}),
+			Entry("add success", sequence, []model.Method{{Id: 1, UserId: 1}}, nil,
+				Result{Saved: []model.Method{{Id: 1, UserId: 1}}}),
 		)
 
 		It("partial flush", func() {
-			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 1}}).Return(nil, nil)
+			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 1}}).Return([]model.Method{{Id: 1, UserId: 1}}, nil)
 			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 2}}).Return(nil, flushErr)
 
 			result := New(1, rep).Flush(defaultCtx, []model.Method{{UserId: 1}, {UserId: 2}})
 
-			Expect(result).To(Equal([]model.Method{{UserId: 2}}))
+			Expect(result).To(Equal(Result{
+				Saved:  []model.Method{{Id: 1, UserId: 1}},
+				Failed: []Failure{{Item: model.Method{UserId: 2}, Err: flushErr}},
+			}))
+		})
+
+		It("isolate poison record", func() {
+			chunk := []model.Method{{UserId: 1}, {UserId: 2}, {UserId: 3}}
+
+			rep.EXPECT().Add(defaultCtx, chunk).Return(nil, flushErr)
+			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 1}}).Return([]model.Method{{Id: 1, UserId: 1}}, nil)
+			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 2}}).Return(nil, flushErr)
+			rep.EXPECT().Add(defaultCtx, []model.Method{{UserId: 3}}).Return([]model.Method{{Id: 3, UserId: 3}}, nil)
+
+			metrics := monitoring.NewFlusherMetrics(nil)
+			result := New(3, rep, WithMetrics(metrics)).Flush(defaultCtx, chunk)
+
+			Expect(result).To(Equal(Result{
+				Saved:  []model.Method{{Id: 1, UserId: 1}, {Id: 3, UserId: 3}},
+				Failed: []Failure{{Item: model.Method{UserId: 2}, Err: flushErr}},
+			}))
+			Expect(testutil.ToFloat64(metrics.Saved)).To(Equal(2.0))
+			Expect(testutil.ToFloat64(metrics.Failed)).To(Equal(1.0))
+			Expect(testutil.ToFloat64(metrics.Split)).To(Equal(1.0))
+		})
+
+		It("flush chunks concurrently", func() {
+			var started sync.WaitGroup
+			started.Add(2)
+
+			rep.EXPECT().
+				Add(defaultCtx, gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					// both chunks have to be in flight to pass the barrier
+					started.Done()
+					started.Wait()
+					return []model.Method{{Id: items[0].UserId, UserId: items[0].UserId}}, nil
+				}).
+				Times(2)
+
+			result := New(1, rep, WithWorkers(4, 2)).Flush(defaultCtx, []model.Method{{UserId: 1}, {UserId: 2}})
+
+			Expect(result).To(Equal(Result{Saved: []model.Method{{Id: 1, UserId: 1}, {Id: 2, UserId: 2}}}))
+		})
+
+		It("context cancelled mid-flush", func() {
+			ctx, cancel := context.WithCancel(defaultCtx)
+
+			rep.EXPECT().
+				Add(ctx, []model.Method{{UserId: 1}}).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					cancel()
+					return []model.Method{{Id: 1, UserId: 1}}, nil
+				})
+
+			result := New(1, rep).Flush(ctx, []model.Method{{UserId: 1}, {UserId: 2}})
+
+			Expect(result).To(Equal(Result{
+				Saved:  []model.Method{{Id: 1, UserId: 1}},
+				Failed: []Failure{{Item: model.Method{UserId: 2}, Err: context.Canceled}},
+			}))
+		})
+
+		It("transient chunk error is not split", func() {
+			chunk := []model.Method{{UserId: 1}, {UserId: 2}}
+			rep.EXPECT().Add(defaultCtx, chunk).Return(nil, driver.ErrBadConn)
+
+			result := New(2, rep).Flush(defaultCtx, chunk)
+
+			Expect(result).To(Equal(Result{Failed: makeFailures(chunk, driver.ErrBadConn)}))
+		})
+
+		It("bulk add above threshold", func() {
+			small := []model.Method{{UserId: 1}}
+			large := []model.Method{{UserId: 2}, {UserId: 3}}
+
+			rep.EXPECT().BulkAdd(defaultCtx, large).Return([]model.Method{{Id: 1, UserId: 2}, {Id: 2, UserId: 3}}, nil)
+			rep.EXPECT().Add(defaultCtx, small).Return([]model.Method{{Id: 3, UserId: 1}}, nil)
+
+			result := New(2, rep, WithBulkThreshold(2)).Flush(defaultCtx, append(large, small...))
+
+			Expect(result).To(Equal(Result{
+				Saved: []model.Method{{Id: 1, UserId: 2}, {Id: 2, UserId: 3}, {Id: 3, UserId: 1}},
+			}))
 		})
 	})
 })
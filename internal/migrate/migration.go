@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+)
+
+// Migration is a goose SQL migration, the version is the numeric prefix of the file name.
+type Migration struct {
+	Version int64
+	Name    string
+}
+
+// Load lists the *.sql migrations of source sorted by version, the migrations themselves are parsed by goose.
+func Load(source fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(source, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	versions := make(map[int64]string, len(files))
+	for _, file := range files {
+		version, err := goose.NumericComponent(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version of %s: %v", file, err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, file)
+		}
+		versions[version] = file
+
+		migrations = append(migrations, Migration{Version: version, Name: strings.TrimSuffix(path.Base(file), ".sql")})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
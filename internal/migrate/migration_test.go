@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		files    fstest.MapFS
+		expected []Migration
+		err      bool
+	}{
+		{
+			files: fstest.MapFS{
+				"20210902_second.sql": {Data: []byte("-- +goose Up\ncreate table b();\n-- +goose Down\ndrop table b;\n")},
+				"20210901_first.sql":  {Data: []byte("-- +goose Up\ncreate table a();\n")},
+				"README.md":           {Data: []byte("not a migration")},
+			},
+			expected: []Migration{
+				{Version: 20210901, Name: "20210901_first"},
+				{Version: 20210902, Name: "20210902_second"},
+			},
+		},
+		{
+			files: fstest.MapFS{"first.sql": {Data: []byte("-- +goose Up\n")}},
+			err:   true,
+		},
+		{
+			files: fstest.MapFS{"0_first.sql": {Data: []byte("-- +goose Up\n")}},
+			err:   true,
+		},
+		{
+			files: fstest.MapFS{
+				"1_first.sql":  {Data: []byte("-- +goose Up\n")},
+				"01_other.sql": {Data: []byte("-- +goose Up\n")},
+			},
+			err: true,
+		},
+	}
+
+	for index, testCase := range testCases {
+		result, err := Load(testCase.files)
+		if (err != nil) != testCase.err {
+			t.Errorf("failed testCase[%d], unexpected err %v", index, err)
+		}
+		if err == nil && !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("failed testCase[%d], expected %+v got %+v", index, testCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package migrate applies the goose SQL migrations embedded into the binary.
+// The applied versions are kept in the goose version table, so the database
+// can be migrated both by the service and by the goose command line tool.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/goose/v3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	table = "migrations"
+
+	// lockKey is the key of the advisory lock, which serializes the migrations of the service replicas.
+	lockKey = 7250615463012948
+)
+
+type dialect struct {
+	goose  string
+	lock   string
+	unlock string
+}
+
+var dialects = map[string]dialect{
+	"pgx": {
+		goose:  "postgres",
+		lock:   "SELECT pg_advisory_lock($1)",
+		unlock: "SELECT pg_advisory_unlock($1)",
+	},
+	// sqlite has no advisory locks, its writers are serialized by the database file lock
+	"sqlite": {
+		goose: "sqlite3",
+	},
+}
+
+// gooseMu guards the goose settings, which are package variables of goose.
+var gooseMu sync.Mutex
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Migration
+
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator interface {
+	// Up applies all pending migrations and returns them.
+	Up(ctx context.Context) ([]Migration, error)
+	// Down rolls back the latest applied migration and returns it.
+	Down(ctx context.Context) ([]Migration, error)
+	// To applies the pending migrations up to the version or rolls back the applied ones above it.
+	To(ctx context.Context, version int64) ([]Migration, error)
+	Status(ctx context.Context) ([]Status, error)
+}
+
+type migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	source     fs.FS
+	migrations []Migration
+}
+
+// New returns the migrator of the migrations from source for the database of the driver.
+func New(db *sql.DB, driver string, source fs.FS) (Migrator, error) {
+	dialect, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("migrations are not supported by driver %q", driver)
+	}
+
+	migrations, err := Load(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{db: db, dialect: dialect, source: source, migrations: migrations}, nil
+}
+
+func (m *migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.run(ctx, func(int64) error {
+		return goose.Up(m.db, ".")
+	})
+}
+
+func (m *migrator) Down(ctx context.Context) ([]Migration, error) {
+	return m.run(ctx, func(current int64) error {
+		if current == 0 {
+			return nil
+		}
+		return goose.Down(m.db, ".")
+	})
+}
+
+func (m *migrator) To(ctx context.Context, version int64) ([]Migration, error) {
+	return m.run(ctx, func(current int64) error {
+		if version < current {
+			return goose.DownTo(m.db, ".", version)
+		}
+		return goose.UpTo(m.db, ".", version)
+	})
+}
+
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	_, err := m.run(ctx, func(int64) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		statuses = make([]Status, 0, len(m.migrations))
+		for _, migration := range m.migrations {
+			status := applied[migration.Version]
+			status.Migration = migration
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// run calls fn with the current version while holding the migration lock
+// and returns the migrations applied or rolled back by it.
+func (m *migrator) run(ctx context.Context, fn func(current int64) error) (done []Migration, err error) {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	goose.SetBaseFS(m.source)
+	goose.SetTableName(table)
+	goose.SetLogger(logger{})
+	if err = goose.SetDialect(m.dialect.goose); err != nil {
+		return nil, err
+	}
+
+	if m.dialect.lock != "" {
+		unlock, err := m.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if unlockErr := unlock(); unlockErr != nil && err == nil {
+				err = unlockErr
+			}
+		}()
+	}
+
+	current, err := goose.GetDBVersion(m.db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed get migrations version")
+	}
+
+	before, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fn(current)
+
+	after, appliedErr := m.applied(ctx)
+	if appliedErr != nil {
+		if err == nil {
+			err = appliedErr
+		}
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if _, ok := after[m.migrations[i].Version]; !ok {
+			if _, ok = before[m.migrations[i].Version]; ok {
+				done = append(done, m.migrations[i])
+			}
+		}
+	}
+	for _, migration := range m.migrations {
+		if _, ok := before[migration.Version]; !ok {
+			if _, ok = after[migration.Version]; ok {
+				done = append(done, migration)
+			}
+		}
+	}
+
+	return done, err
+}
+
+// lock takes the advisory lock on a dedicated session, goose runs the migrations on the other connections of the pool.
+func (m *migrator) lock(ctx context.Context) (func() error, error) {
+	if m.db.Stats().MaxOpenConnections == 1 {
+		return nil, errors.New("migrations need more than one database connection")
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.ExecContext(ctx, m.dialect.lock, lockKey); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "failed acquire migration lock")
+	}
+
+	return func() error {
+		// the lock is released with the session if the unlock fails
+		_, err := conn.ExecContext(context.Background(), m.dialect.unlock, lockKey)
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// applied returns the applied migrations by their versions, the latest record of a version defines its state.
+func (m *migrator) applied(ctx context.Context) (map[int64]Status, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM "+table+" ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int64]bool)
+	applied := make(map[int64]Status)
+	for rows.Next() {
+		var (
+			version   int64
+			isApplied bool
+			appliedAt sql.NullTime
+		)
+		if err = rows.Scan(&version, &isApplied, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+
+		if isApplied && version > 0 {
+			applied[version] = Status{Applied: true, AppliedAt: appliedAt.Time}
+		}
+	}
+
+	return applied, rows.Err()
+}
+
+// logger writes the goose output to the service log.
+type logger struct{}
+
+func (logger) Fatal(v ...interface{}) { log.Fatal().Msg(fmt.Sprint(v...)) }
+
+func (logger) Fatalf(format string, v ...interface{}) { log.Fatal().Msgf(format, v...) }
+
+func (logger) Print(v ...interface{}) { log.Debug().Msg(fmt.Sprint(v...)) }
+
+func (logger) Println(v ...interface{}) { log.Debug().Msg(fmt.Sprint(v...)) }
+
+func (logger) Printf(format string, v ...interface{}) { log.Debug().Msgf(format, v...) }
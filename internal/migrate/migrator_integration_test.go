@@ -0,0 +1,66 @@
+//go:build integration
+
+package migrate_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"ova-method-api/internal/migrate"
+	"ova-method-api/internal/testdb"
+)
+
+func TestMigratorIntegration(t *testing.T) {
+	db, err := testdb.Start("../../migrations")
+	if err != nil {
+		t.Fatalf("failed start test database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db.DB.DB, "pgx", os.DirFS("../../migrations"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	assertApplied := func(t *testing.T, expected ...bool) {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(statuses) != len(expected) {
+			t.Fatalf("expected %d migrations, got %d", len(expected), len(statuses))
+		}
+		for i, status := range statuses {
+			if status.Applied != expected[i] {
+				t.Errorf("migration %s expected applied %v", status.Name, expected[i])
+			}
+		}
+	}
+
+	assertApplied(t, true, true)
+
+	migrated, err := migrator.Up(ctx)
+	if err != nil || len(migrated) != 0 {
+		t.Fatalf("expected no pending migrations, got %v with err %v", migrated, err)
+	}
+
+	migrated, err = migrator.Down(ctx)
+	if err != nil || len(migrated) != 1 {
+		t.Fatalf("expected one rolled back migration, got %v with err %v", migrated, err)
+	}
+	assertApplied(t, true, false)
+
+	statuses, _ := migrator.Status(ctx)
+	if _, err = migrator.To(ctx, statuses[0].Version-1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertApplied(t, false, false)
+
+	migrated, err = migrator.Up(ctx)
+	if err != nil || len(migrated) != 2 {
+		t.Fatalf("expected two applied migrations, got %v with err %v", migrated, err)
+	}
+	assertApplied(t, true, true)
+}
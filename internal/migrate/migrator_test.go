@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "migrate.db")+"?_time_format=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	source := fstest.MapFS{
+		"1_first.sql":  {Data: []byte("-- +goose Up\ncreate table first (id integer);\n-- +goose Down\ndrop table first;\n")},
+		"2_second.sql": {Data: []byte("-- +goose Up\ncreate table second (id integer);\n-- +goose Down\ndrop table second;\n")},
+		"3_third.sql": {Data: []byte(`-- +goose Up
+-- +goose StatementBegin
+create trigger third after insert on first
+begin
+	insert into second (id) values (new.id);
+	insert into second (id) values (new.id + 1);
+end;
+-- +goose StatementEnd
+
+-- +goose Down
+drop trigger third;
+`)},
+	}
+	migrator, err := New(db, "sqlite", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	assertMigrated := func(t *testing.T, migrated []Migration, err error, expected ...int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(migrated) != len(expected) {
+			t.Fatalf("expected migrations %v, got %v", expected, migrated)
+		}
+		for i, migration := range migrated {
+			if migration.Version != expected[i] {
+				t.Errorf("expected migrations %v, got %v", expected, migrated)
+			}
+		}
+	}
+	assertApplied := func(t *testing.T, expected ...bool) {
+		t.Helper()
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, status := range statuses {
+			if status.Applied != expected[i] || status.Applied == status.AppliedAt.IsZero() {
+				t.Errorf("migration %s expected applied %v, got %+v", status.Name, expected[i], status)
+			}
+		}
+	}
+
+	migrated, err := migrator.To(ctx, 2)
+	assertMigrated(t, migrated, err, 1, 2)
+	assertApplied(t, true, true, false)
+
+	migrated, err = migrator.Up(ctx)
+	assertMigrated(t, migrated, err, 3)
+
+	migrated, err = migrator.Down(ctx)
+	assertMigrated(t, migrated, err, 3)
+	assertApplied(t, true, true, false)
+
+	migrated, err = migrator.To(ctx, 0)
+	assertMigrated(t, migrated, err, 2, 1)
+	assertApplied(t, false, false, false)
+
+	migrated, err = migrator.Down(ctx)
+	assertMigrated(t, migrated, err)
+
+	if _, err = New(db, "mysql", source); err == nil {
+		t.Errorf("expected unsupported driver error")
+	}
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// DeadLetter is a queue message which failed to be published.
+type DeadLetter struct {
+	Id            uint64    `db:"id"`
+	Topic         string    `db:"topic"`
+	Key           string    `db:"key"`
+	Headers       string    `db:"headers"`
+	Payload       []byte    `db:"payload"`
+	Error         string    `db:"error"`
+	Attempts      uint      `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
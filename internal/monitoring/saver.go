@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SaverMetrics instruments the saver buffer and its background flushes.
+type SaverMetrics struct {
+	BufferItems   prometheus.Gauge
+	BufferBytes   prometheus.Gauge
+	FlushDuration prometheus.Histogram
+	Flushed       prometheus.Counter
+	Retries       prometheus.Counter
+	Rejected      prometheus.Counter
+	Dropped       prometheus.Counter
+}
+
+// FlusherMetrics instruments the chunks written by the flusher.
+type FlusherMetrics struct {
+	ChunkDuration prometheus.Histogram
+	Saved         prometheus.Counter
+	Failed        prometheus.Counter
+	// Split counts chunks retried row by row to isolate a bad record
+	Split prometheus.Counter
+}
+
+// NewSaverMetrics creates the saver metrics registered by registerer.
+// A nil registerer creates unregistered metrics, which is useful as a no-op default.
+func NewSaverMetrics(registerer prometheus.Registerer) SaverMetrics {
+	factory := promauto.With(registerer)
+
+	return SaverMetrics{
+		BufferItems: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "saver_buffer_items",
+			Help: "Number of items in the active saver buffer",
+		}),
+		BufferBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "saver_buffer_bytes",
+			Help: "Total length of values in the active saver buffer",
+		}),
+		FlushDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "saver_flush_duration_seconds",
+			Help:    "Duration of the saver buffer flush including retries",
+			Buckets: prometheus.DefBuckets,
+		}),
+		Flushed: factory.NewCounter(prometheus.CounterOpts{
+			Name: "saver_items_flushed",
+			Help: "Number of items flushed by the saver",
+		}),
+		Retries: factory.NewCounter(prometheus.CounterOpts{
+			Name: "saver_flush_retries",
+			Help: "Number of retried saver flushes",
+		}),
+		Rejected: factory.NewCounter(prometheus.CounterOpts{
+			Name: "saver_items_rejected",
+			Help: "Number of items rejected by the saver after a permanent error",
+		}),
+		Dropped: factory.NewCounter(prometheus.CounterOpts{
+			Name: "saver_items_dropped",
+			Help: "Number of items dropped by the saver backpressure policy",
+		}),
+	}
+}
+
+// NewFlusherMetrics creates the flusher metrics registered by registerer.
+// A nil registerer creates unregistered metrics, which is useful as a no-op default.
+func NewFlusherMetrics(registerer prometheus.Registerer) FlusherMetrics {
+	factory := promauto.With(registerer)
+
+	return FlusherMetrics{
+		ChunkDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "flusher_chunk_duration_seconds",
+			Help:    "Duration of a chunk insert",
+			Buckets: prometheus.DefBuckets,
+		}),
+		Saved: factory.NewCounter(prometheus.CounterOpts{
+			Name: "flusher_items_saved",
+			Help: "Number of items saved by the flusher",
+		}),
+		Failed: factory.NewCounter(prometheus.CounterOpts{
+			Name: "flusher_items_failed",
+			Help: "Number of items failed by the flusher",
+		}),
+		Split: factory.NewCounter(prometheus.CounterOpts{
+			Name: "flusher_chunks_split",
+			Help: "Number of chunks retried row by row after a permanent error",
+		}),
+	}
+}
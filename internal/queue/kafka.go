@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"sort"
+
 	"github.com/Shopify/sarama"
 	"github.com/rs/zerolog/log"
 )
@@ -30,16 +32,11 @@ func (kafka *kafkaProvider) Close() error {
 }
 
 func (kafka *kafkaProvider) Send(queueName string, msg QueueMsg) error {
-	bytes, err := msg.MarshalJSON()
+	kafkaMsg, err := makeProducerMessage(queueName, msg)
 	if err != nil {
 		return err
 	}
 
-	kafkaMsg := &sarama.ProducerMessage{
-		Topic: queueName,
-		Value: sarama.ByteEncoder(bytes),
-	}
-
 	partition, offset, err := kafka.producer.SendMessage(kafkaMsg)
 	if err != nil {
 		return err
@@ -47,10 +44,48 @@ func (kafka *kafkaProvider) Send(queueName string, msg QueueMsg) error {
 
 	log.Debug().
 		Str("topic", queueName).
-		Str("msg", string(bytes)).
+		Str("key", msg.Key()).
+		Str("msg", string(kafkaMsg.Value.(sarama.ByteEncoder))).
 		Int32("partition", partition).
 		Int64("offset", offset).
 		Msg("send")
 
 	return nil
 }
+
+func makeProducerMessage(queueName string, msg QueueMsg) (*sarama.ProducerMessage, error) {
+	bytes, err := msg.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	kafkaMsg := &sarama.ProducerMessage{
+		Topic:   queueName,
+		Value:   sarama.ByteEncoder(bytes),
+		Headers: makeHeaders(msg.Headers()),
+	}
+
+	if key := msg.Key(); key != "" {
+		kafkaMsg.Key = sarama.StringEncoder(key)
+	}
+
+	return kafkaMsg, nil
+}
+
+func makeHeaders(headers Headers) []sarama.RecordHeader {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]sarama.RecordHeader, 0, len(headers))
+	for _, name := range names {
+		result = append(result, sarama.RecordHeader{
+			Key:   []byte(name),
+			Value: []byte(headers[name]),
+		})
+	}
+
+	return result
+}
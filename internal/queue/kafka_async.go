@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrQueueClosed = fmt.Errorf("queue is closed")
+)
+
+// AsyncCallbacks are invoked from the background goroutines of the async provider
+// once the broker has acknowledged or rejected a message.
+type AsyncCallbacks struct {
+	OnSuccess func(topic string)
+	OnError   func(topic string, msg QueueMsg, err error)
+}
+
+type asyncKafkaProvider struct {
+	sync.RWMutex
+
+	newProducer func() (sarama.AsyncProducer, error)
+	callbacks   AsyncCallbacks
+
+	closed   bool
+	wg       sync.WaitGroup
+	producer sarama.AsyncProducer
+}
+
+// NewAsyncKafkaProvider creates a provider which enqueues messages without waiting for the broker.
+// Batching and the size of the in-flight buffer are controlled by config.Producer.Flush
+// and config.ChannelBufferSize; Send blocks while the buffer is full.
+func NewAsyncKafkaProvider(brokers []string, config *sarama.Config, callbacks AsyncCallbacks) Queue {
+	return &asyncKafkaProvider{
+		newProducer: func() (sarama.AsyncProducer, error) {
+			config.Producer.Return.Errors = true
+			return sarama.NewAsyncProducer(brokers, config)
+		},
+		callbacks: callbacks,
+	}
+}
+
+// NewAsyncProducerProvider creates the async provider of an already created producer, the producer
+// has to return errors, and successes too for OnSuccess to be invoked.
+func NewAsyncProducerProvider(producer sarama.AsyncProducer, callbacks AsyncCallbacks) Queue {
+	return &asyncKafkaProvider{
+		newProducer: func() (sarama.AsyncProducer, error) {
+			return producer, nil
+		},
+		callbacks: callbacks,
+	}
+}
+
+func (kafka *asyncKafkaProvider) Connect() error {
+	conn, err := kafka.newProducer()
+	if err != nil {
+		return err
+	}
+
+	kafka.producer = conn
+
+	kafka.wg.Add(2)
+	go kafka.handleSuccesses()
+	go kafka.handleErrors()
+
+	return nil
+}
+
+func (kafka *asyncKafkaProvider) handleSuccesses() {
+	defer kafka.wg.Done()
+
+	for msg := range kafka.producer.Successes() {
+		log.Debug().
+			Str("topic", msg.Topic).
+			Int32("partition", msg.Partition).
+			Int64("offset", msg.Offset).
+			Msg("send")
+
+		if kafka.callbacks.OnSuccess != nil {
+			kafka.callbacks.OnSuccess(msg.Topic)
+		}
+	}
+}
+
+func (kafka *asyncKafkaProvider) handleErrors() {
+	defer kafka.wg.Done()
+
+	for producerErr := range kafka.producer.Errors() {
+		log.Error().
+			Str("topic", producerErr.Msg.Topic).
+			Err(producerErr.Err).
+			Msg("failed send message to queue")
+
+		if kafka.callbacks.OnError != nil {
+			msg, _ := producerErr.Msg.Metadata.(QueueMsg)
+			kafka.callbacks.OnError(producerErr.Msg.Topic, msg, producerErr.Err)
+		}
+	}
+}
+
+// Close flushes buffered messages and waits until all of them are acknowledged or failed.
+func (kafka *asyncKafkaProvider) Close() error {
+	kafka.Lock()
+	if kafka.closed {
+		kafka.Unlock()
+		return nil
+	}
+	kafka.closed = true
+	kafka.Unlock()
+
+	kafka.producer.AsyncClose()
+	kafka.wg.Wait()
+
+	return nil
+}
+
+func (kafka *asyncKafkaProvider) Send(queueName string, msg QueueMsg) error {
+	kafkaMsg, err := makeProducerMessage(queueName, msg)
+	if err != nil {
+		return err
+	}
+	kafkaMsg.Metadata = msg
+
+	kafka.RLock()
+	defer kafka.RUnlock()
+
+	if kafka.closed {
+		return ErrQueueClosed
+	}
+
+	kafka.producer.Input() <- kafkaMsg
+	return nil
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+type asyncResults struct {
+	sync.Mutex
+
+	sent   []string
+	failed []QueueMsg
+	errs   []error
+}
+
+func (r *asyncResults) callbacks() AsyncCallbacks {
+	return AsyncCallbacks{
+		OnSuccess: func(topic string) {
+			r.Lock()
+			defer r.Unlock()
+			r.sent = append(r.sent, topic)
+		},
+		OnError: func(topic string, msg QueueMsg, err error) {
+			r.Lock()
+			defer r.Unlock()
+			r.failed = append(r.failed, msg)
+			r.errs = append(r.errs, err)
+		},
+	}
+}
+
+func newMockAsyncProducer(t *testing.T) *mocks.AsyncProducer {
+	config := mocks.NewTestConfig()
+	config.ChannelBufferSize = 10
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	return mocks.NewAsyncProducer(t, config)
+}
+
+func TestAsyncKafkaProviderClose(t *testing.T) {
+	producer := newMockAsyncProducer(t)
+	sendErr := errors.New("broker is down")
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sendErr)
+	producer.ExpectInputAndSucceed()
+
+	results := &asyncResults{}
+	queue := NewAsyncProducerProvider(producer, results.callbacks())
+	if err := queue.Connect(); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	msgs := []QueueMsg{
+		NewMessage(ActionCreated, Body{"id": 1}),
+		NewMessage(ActionUpdated, Body{"id": 2}),
+		NewMessage(ActionDeleted, Body{"id": 3}),
+	}
+	for _, msg := range msgs {
+		if err := queue.Send("ova-method", msg); err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+	}
+
+	// Close returns once every buffered message is acknowledged or failed
+	if err := queue.Close(); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	results.Lock()
+	defer results.Unlock()
+	if len(results.sent) != 2 || results.sent[0] != "ova-method" {
+		t.Errorf("expected 2 sent messages got %v", results.sent)
+	}
+	if len(results.failed) != 1 || results.failed[0] != msgs[1] {
+		t.Errorf("expected the failed message %v got %v", msgs[1], results.failed)
+	}
+	if len(results.errs) != 1 || !errors.Is(results.errs[0], sendErr) {
+		t.Errorf("expected error '%v' got %v", sendErr, results.errs)
+	}
+
+	if err := queue.Send("ova-method", msgs[0]); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected error '%v' got '%v'", ErrQueueClosed, err)
+	}
+	if err := queue.Close(); err != nil {
+		t.Errorf("unexpected error '%v' on second close", err)
+	}
+}
+
+func TestAsyncKafkaProviderWithoutCallbacks(t *testing.T) {
+	producer := newMockAsyncProducer(t)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	queue := NewAsyncProducerProvider(producer, AsyncCallbacks{})
+	if err := queue.Connect(); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Send("ova-method", NewMessage(ActionCreated, Body{"id": i})); err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+	}
+
+	if err := queue.Close(); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+func ParseRequiredAcks(value string) (sarama.RequiredAcks, error) {
+	switch strings.ToLower(value) {
+	case "none", "0":
+		return sarama.NoResponse, nil
+	case "leader", "1":
+		return sarama.WaitForLocal, nil
+	case "all", "-1":
+		return sarama.WaitForAll, nil
+	default:
+		return 0, fmt.Errorf("unknown acks value %q", value)
+	}
+}
+
+func ParseCompressionCodec(value string) (sarama.CompressionCodec, error) {
+	switch strings.ToLower(value) {
+	case "none", "":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", value)
+	}
+}
+
+func ParseSASLMechanism(value string) (sarama.SASLMechanism, error) {
+	switch mechanism := sarama.SASLMechanism(strings.ToUpper(value)); mechanism {
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		return mechanism, nil
+	default:
+		return "", fmt.Errorf("unsupported sasl mechanism %q", value)
+	}
+}
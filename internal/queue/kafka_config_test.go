@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseRequiredAcks(t *testing.T) {
+	testCases := []struct {
+		value       string
+		expected    sarama.RequiredAcks
+		expectedErr bool
+	}{
+		{value: "none", expected: sarama.NoResponse},
+		{value: "0", expected: sarama.NoResponse},
+		{value: "leader", expected: sarama.WaitForLocal},
+		{value: "1", expected: sarama.WaitForLocal},
+		{value: "ALL", expected: sarama.WaitForAll},
+		{value: "-1", expected: sarama.WaitForAll},
+		{value: "", expectedErr: true},
+		{value: "2", expectedErr: true},
+	}
+
+	for index, testCase := range testCases {
+		result, err := ParseRequiredAcks(testCase.value)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+		if result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
+
+func TestParseCompressionCodec(t *testing.T) {
+	testCases := []struct {
+		value       string
+		expected    sarama.CompressionCodec
+		expectedErr bool
+	}{
+		{value: "", expected: sarama.CompressionNone},
+		{value: "none", expected: sarama.CompressionNone},
+		{value: "gzip", expected: sarama.CompressionGZIP},
+		{value: "Snappy", expected: sarama.CompressionSnappy},
+		{value: "lz4", expected: sarama.CompressionLZ4},
+		{value: "zstd", expected: sarama.CompressionZSTD},
+		{value: "brotli", expectedErr: true},
+	}
+
+	for index, testCase := range testCases {
+		result, err := ParseCompressionCodec(testCase.value)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+		if result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
+
+func TestParseSASLMechanism(t *testing.T) {
+	testCases := []struct {
+		value       string
+		expected    sarama.SASLMechanism
+		expectedErr bool
+	}{
+		{value: "plain", expected: sarama.SASLTypePlaintext},
+		{value: "SCRAM-SHA-256", expected: sarama.SASLTypeSCRAMSHA256},
+		{value: "scram-sha-512", expected: sarama.SASLTypeSCRAMSHA512},
+		{value: "", expectedErr: true},
+		{value: "GSSAPI", expectedErr: true},
+	}
+
+	for index, testCase := range testCases {
+		result, err := ParseSASLMechanism(testCase.value)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+		if result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
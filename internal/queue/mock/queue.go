@@ -99,17 +99,45 @@ func (m *MockQueueMsg) EXPECT() *MockQueueMsgMockRecorder {
 	return m.recorder
 }
 
-// MarshalJSON mocks base method.
-func (m *MockQueueMsg) MarshalJSON() ([]byte, error) {
+// Encode mocks base method.
+func (m *MockQueueMsg) Encode() ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "MarshalJSON")
+	ret := m.ctrl.Call(m, "Encode")
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// MarshalJSON indicates an expected call of MarshalJSON.
-func (mr *MockQueueMsgMockRecorder) MarshalJSON() *gomock.Call {
+// Encode indicates an expected call of Encode.
+func (mr *MockQueueMsgMockRecorder) Encode() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarshalJSON", reflect.TypeOf((*MockQueueMsg)(nil).MarshalJSON))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encode", reflect.TypeOf((*MockQueueMsg)(nil).Encode))
+}
+
+// Headers mocks base method.
+func (m *MockQueueMsg) Headers() queue.Headers {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Headers")
+	ret0, _ := ret[0].(queue.Headers)
+	return ret0
+}
+
+// Headers indicates an expected call of Headers.
+func (mr *MockQueueMsgMockRecorder) Headers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Headers", reflect.TypeOf((*MockQueueMsg)(nil).Headers))
+}
+
+// Key mocks base method.
+func (m *MockQueueMsg) Key() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Key")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Key indicates an expected call of Key.
+func (mr *MockQueueMsgMockRecorder) Key() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Key", reflect.TypeOf((*MockQueueMsg)(nil).Key))
 }
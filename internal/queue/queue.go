@@ -1,9 +1,40 @@
 package queue
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opentracing/opentracing-go"
+)
 
 //go:generate mockgen -source=$GOFILE -destination=./mock/queue.go -package=mock
 
+const (
+	HeaderAction      = "action"
+	HeaderContentType = "content-type"
+
+	ContentTypeJson = "application/json"
+)
+
+// KeyStrategy defines which field of the method is used as a message key,
+// so that events of the same entity land in the same partition.
+type KeyStrategy string
+
+const (
+	KeyByMethodId KeyStrategy = "methodId"
+	KeyByUserId   KeyStrategy = "userId"
+)
+
+func ParseKeyStrategy(value string) (KeyStrategy, error) {
+	switch strategy := KeyStrategy(value); strategy {
+	case KeyByMethodId, KeyByUserId:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown key strategy %q", value)
+	}
+}
+
 type Queue interface {
 	Connect() error
 	Close() error
@@ -11,20 +42,80 @@ type Queue interface {
 }
 
 type QueueMsg interface {
-	json.Marshaler
+	Key() string
+	Headers() Headers
+	Encode() ([]byte, error)
 }
 
 type Body map[string]interface{}
 
+type Headers map[string]string
+
+type MessageOption func(m *message)
+
+// WithKey sets the partitioning key of the message.
+func WithKey(key string) MessageOption {
+	return func(m *message) {
+		m.key = key
+	}
+}
+
+// WithHeader adds an arbitrary header to the message.
+func WithHeader(name, value string) MessageOption {
+	return func(m *message) {
+		m.headers[name] = value
+	}
+}
+
+// WithTraceContext injects the span context from ctx into the message headers.
+func WithTraceContext(ctx context.Context) MessageOption {
+	return func(m *message) {
+		span := opentracing.SpanFromContext(ctx)
+		if span == nil {
+			return
+		}
+
+		_ = opentracing.GlobalTracer().Inject(
+			span.Context(),
+			opentracing.TextMap,
+			opentracing.TextMapCarrier(m.headers),
+		)
+	}
+}
+
 type message struct {
 	Action string      `json:"action"`
 	Body   interface{} `json:"body"`
+
+	key     string
+	headers Headers
+}
+
+func NewMessage(action string, msg interface{}, opts ...MessageOption) QueueMsg {
+	m := &message{
+		Action: action,
+		Body:   msg,
+		headers: Headers{
+			HeaderAction:      action,
+			HeaderContentType: ContentTypeJson,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *message) Key() string {
+	return m.key
 }
 
-func NewMessage(action string, msg interface{}) QueueMsg {
-	return &message{Action: action, Body: msg}
+func (m *message) Headers() Headers {
+	return m.headers
 }
 
-func (m *message) MarshalJSON() ([]byte, error) {
+func (m *message) Encode() ([]byte, error) {
 	return json.Marshal(*m)
 }
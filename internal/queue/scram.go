@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+func sha256Hash() hash.Hash { return sha256.New() }
+
+func sha512Hash() hash.Hash { return sha512.New() }
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram.
+type scramClient struct {
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func NewScramClientGenerator(mechanism sarama.SASLMechanism) func() sarama.SCRAMClient {
+	hashGenerator := scram.HashGeneratorFcn(sha256Hash)
+	if mechanism == sarama.SASLTypeSCRAMSHA512 {
+		hashGenerator = sha512Hash
+	}
+
+	return func() sarama.SCRAMClient {
+		return &scramClient{HashGeneratorFcn: hashGenerator}
+	}
+}
+
+func (client *scramClient) Begin(userName, password, authzID string) error {
+	conn, err := client.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+
+	client.ClientConversation = conn.NewConversation()
+	return nil
+}
+
+func (client *scramClient) Step(challenge string) (string, error) {
+	return client.ClientConversation.Step(challenge)
+}
+
+func (client *scramClient) Done() bool {
+	return client.ClientConversation.Done()
+}
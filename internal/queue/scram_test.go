@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestNewScramClientGenerator(t *testing.T) {
+	testCases := []struct {
+		mechanism    sarama.SASLMechanism
+		expectedSize int
+	}{
+		{mechanism: sarama.SASLTypeSCRAMSHA256, expectedSize: 32},
+		{mechanism: sarama.SASLTypeSCRAMSHA512, expectedSize: 64},
+	}
+
+	for index, testCase := range testCases {
+		client := NewScramClientGenerator(testCase.mechanism)()
+
+		if size := client.(*scramClient).HashGeneratorFcn().Size(); size != testCase.expectedSize {
+			t.Errorf("failed testCase[%d], expected hash size %d got %d", index, testCase.expectedSize, size)
+		}
+
+		if err := client.Begin("user", "pass", ""); err != nil {
+			t.Fatalf("failed testCase[%d], unexpected error '%v'", index, err)
+		}
+		first, err := client.Step("")
+		if err != nil {
+			t.Fatalf("failed testCase[%d], unexpected error '%v'", index, err)
+		}
+		if !strings.HasPrefix(first, "n,,n=user,r=") {
+			t.Errorf("failed testCase[%d], unexpected client first message %q", index, first)
+		}
+		if client.Done() {
+			t.Errorf("failed testCase[%d], conversation is done before the server answer", index)
+		}
+	}
+}
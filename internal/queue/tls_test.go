@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir.
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ova-method-api"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalidFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		caFile, certFile, keyFile string
+		insecure                  bool
+		expectedRootCAs           bool
+		expectedCertificates      int
+		expectedErr               bool
+	}{
+		{},
+		{insecure: true},
+		{caFile: certFile, expectedRootCAs: true},
+		{caFile: certFile, certFile: certFile, keyFile: keyFile, expectedRootCAs: true, expectedCertificates: 1},
+		// the client certificate is loaded only with its key
+		{certFile: certFile},
+		{caFile: filepath.Join(dir, "missing.pem"), expectedErr: true},
+		{caFile: invalidFile, expectedErr: true},
+		{certFile: certFile, keyFile: invalidFile, expectedErr: true},
+	}
+
+	for index, testCase := range testCases {
+		config, err := NewTLSConfig(testCase.caFile, testCase.certFile, testCase.keyFile, testCase.insecure)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if config.InsecureSkipVerify != testCase.insecure {
+			t.Errorf("failed testCase[%d], expected insecure %v", index, testCase.insecure)
+		}
+		if (config.RootCAs != nil) != testCase.expectedRootCAs {
+			t.Errorf("failed testCase[%d], expected root CAs %v", index, testCase.expectedRootCAs)
+		}
+		if len(config.Certificates) != testCase.expectedCertificates {
+			t.Errorf("failed testCase[%d], expected %d certificates got %d", index, testCase.expectedCertificates, len(config.Certificates))
+		}
+	}
+}
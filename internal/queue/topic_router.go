@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+
+	maxTopicNameLen = 249
+)
+
+var (
+	knownActions = map[string]struct{}{
+		ActionCreated: {},
+		ActionUpdated: {},
+		ActionDeleted: {},
+	}
+
+	topicNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+type TopicRouter interface {
+	Route(action string) string
+}
+
+type topicRouter struct {
+	defaultTopic string
+	actions      map[string]string
+}
+
+// NewTopicRouter validates the routing table so that misconfigured topics fail on startup.
+// Actions missing from the table are sent to defaultTopic.
+func NewTopicRouter(defaultTopic string, actions map[string]string) (TopicRouter, error) {
+	if err := validateTopicName(defaultTopic); err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]string, len(actions))
+	for action, topic := range actions {
+		if _, ok := knownActions[action]; !ok {
+			return nil, fmt.Errorf("unknown action %q in topic routes", action)
+		}
+		if err := validateTopicName(topic); err != nil {
+			return nil, fmt.Errorf("action %q: %w", action, err)
+		}
+		routes[action] = topic
+	}
+
+	return &topicRouter{defaultTopic: defaultTopic, actions: routes}, nil
+}
+
+func (router *topicRouter) Route(action string) string {
+	if topic, ok := router.actions[action]; ok {
+		return topic
+	}
+	return router.defaultTopic
+}
+
+func validateTopicName(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic name cannot be empty")
+	}
+	if topic == "." || topic == ".." {
+		return fmt.Errorf("invalid topic name %q", topic)
+	}
+	if len(topic) > maxTopicNameLen {
+		return fmt.Errorf("topic name %q is longer than %d", topic, maxTopicNameLen)
+	}
+	if !topicNameRegexp.MatchString(topic) {
+		return fmt.Errorf("topic name %q contains illegal characters", topic)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"testing"
+)
+
+func TestNewTopicRouter(t *testing.T) {
+	testCases := []struct {
+		defaultTopic string
+		actions      map[string]string
+		expectedErr  bool
+	}{
+		{defaultTopic: "ova-method"},
+		{defaultTopic: "ova-method", actions: map[string]string{ActionCreated: "ova.method_created"}},
+		{defaultTopic: "", expectedErr: true},
+		{defaultTopic: "..", expectedErr: true},
+		{defaultTopic: "ova method", expectedErr: true},
+		{defaultTopic: "ova-method", actions: map[string]string{"creatd": "ova-method"}, expectedErr: true},
+		{defaultTopic: "ova-method", actions: map[string]string{ActionDeleted: "ova/method"}, expectedErr: true},
+	}
+
+	for index, testCase := range testCases {
+		_, err := NewTopicRouter(testCase.defaultTopic, testCase.actions)
+		if (err != nil) != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected %v got '%v'", index, testCase.expectedErr, err)
+		}
+	}
+}
+
+func TestTopicRouterRoute(t *testing.T) {
+	router, err := NewTopicRouter("ova-method", map[string]string{ActionDeleted: "ova-method-deleted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		action   string
+		expected string
+	}{
+		{action: ActionCreated, expected: "ova-method"},
+		{action: ActionUpdated, expected: "ova-method"},
+		{action: ActionDeleted, expected: "ova-method-deleted"},
+	}
+
+	for index, testCase := range testCases {
+		if topic := router.Route(testCase.action); topic != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, topic)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -23,26 +24,175 @@ type Transactionable interface {
 	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
 }
 
+const defaultTxMaxAttempts = 3
+
+// Option configures a repository.
+type Option func(rep *baseRepo)
+
+// WithTxMaxAttempts sets how many times a transaction is run when it fails with a serialization
+// failure or a deadlock; it can be overridden per transaction by WithMaxAttempts.
+func WithTxMaxAttempts(attempts uint) Option {
+	return func(rep *baseRepo) {
+		rep.txMaxAttempts = attempts
+	}
+}
+
+// WithReplicas routes reads, which are not a part of a transaction, to the replicas.
+func WithReplicas(replicas Replicas) Option {
+	return func(rep *baseRepo) {
+		rep.replicas = replicas
+	}
+}
+
+// Timeouts bound the operations called with a context without a deadline, a zero timeout disables the bound.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Bulk  time.Duration
+}
+
+// WithTimeouts sets the default timeouts of the read, write and bulk operations,
+// so a request without a deadline can't hold a pooled connection indefinitely.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(rep *baseRepo) {
+		rep.timeouts = timeouts
+	}
+}
+
+// TxOption configures a single transaction.
+type TxOption func(config *txConfig)
+
+type txConfig struct {
+	options     *sql.TxOptions
+	maxAttempts uint
+}
+
+// WithTxOptions sets the isolation level and the read-only mode of the transaction.
+func WithTxOptions(options *sql.TxOptions) TxOption {
+	return func(config *txConfig) {
+		config.options = options
+	}
+}
+
+// WithMaxAttempts sets how many times the transaction is run on serialization failures and deadlocks.
+func WithMaxAttempts(attempts uint) TxOption {
+	return func(config *txConfig) {
+		config.maxAttempts = attempts
+	}
+}
+
 type baseRepo struct {
-	conn Connection
+	conn          Connection
+	replicas      Replicas
+	txMaxAttempts uint
+	timeouts      Timeouts
 }
 
-func newBaseRepo(conn Connection) baseRepo {
-	return baseRepo{conn}
+func newBaseRepo(conn Connection, opts ...Option) baseRepo {
+	rep := baseRepo{conn: conn, txMaxAttempts: defaultTxMaxAttempts}
+	for _, opt := range opts {
+		opt(&rep)
+	}
+	return rep
+}
+
+// withTimeout bounds ctx by the timeout unless ctx already has a deadline.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// txConnection is a connection bound to a transaction, depth is the number of enclosing savepoints.
+type txConnection struct {
+	*sqlx.Tx
+	depth int
+}
+
+type txContextKey struct{}
+
+// withTx returns a context carrying the transaction, repositories called with it join the transaction.
+func withTx(ctx context.Context, tx *txConnection) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
 }
 
-func (rep *baseRepo) Transaction(ctx context.Context, fn func(conn Connection) error) error {
-	txConn, ok := rep.conn.(Transactionable)
+// connection returns the transaction carried by ctx or the connection of the repository.
+func (rep *baseRepo) connection(ctx context.Context) Connection {
+	if tx, ok := ctx.Value(txContextKey{}).(*txConnection); ok {
+		return tx
+	}
+	return rep.conn
+}
+
+// read runs the read-only fn on a replica unless ctx carries a transaction or requires
+// read-your-writes consistency. When all replicas are down, or the replica fails with
+// a transient error, fn is run on the primary.
+func (rep *baseRepo) read(ctx context.Context, fn func(conn Connection) error) error {
+	conn := rep.connection(ctx)
+	if rep.replicas == nil || conn != rep.conn || isReadYourWrites(ctx) {
+		return fn(conn)
+	}
+
+	replica, ok := rep.replicas.Next()
+	if !ok {
+		return fn(conn)
+	}
+
+	err := fn(replica)
+	if err != nil && ctx.Err() == nil && IsTransient(err) {
+		rep.replicas.MarkDown(replica)
+		return fn(conn)
+	}
+	return err
+}
+
+// Transaction runs fn inside a transaction. The transaction aborted by a serialization failure
+// or a deadlock is run again, so fn must not have side effects outside of the database.
+// Inside another transaction fn is run under a savepoint, tx options are ignored in this case.
+func (rep *baseRepo) Transaction(ctx context.Context, fn func(conn Connection) error, opts ...TxOption) error {
+	conn := rep.connection(ctx)
+	switch tx := conn.(type) {
+	case *txConnection:
+		return runSavepoint(ctx, tx, fn)
+	case *sqlx.Tx:
+		return runSavepoint(ctx, &txConnection{Tx: tx}, fn)
+	}
+
+	txConn, ok := conn.(Transactionable)
 	if !ok {
 		return fmt.Errorf("transactions are not supported")
 	}
 
-	tx, err := txConn.BeginTxx(ctx, nil)
+	config := txConfig{maxAttempts: rep.txMaxAttempts}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	// the transaction is rolled back when ctx is done, so the write timeout bounds all its attempts
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Write)
+	defer cancel()
+
+	for attempt := uint(1); ; attempt++ {
+		err := rep.runTx(ctx, txConn, config.options, fn)
+		if err == nil || attempt >= config.maxAttempts || !IsSerializationFailure(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func (rep *baseRepo) runTx(
+	ctx context.Context,
+	txConn Transactionable,
+	options *sql.TxOptions,
+	fn func(conn Connection) error,
+) error {
+	tx, err := txConn.BeginTxx(ctx, options)
 	if err != nil {
 		return err
 	}
 
-	if err = fn(tx); err != nil {
+	if err = fn(&txConnection{Tx: tx}); err != nil {
 		if txErr := tx.Rollback(); txErr != nil {
 			return errors.Wrapf(err, "tx error %+v with err:", txErr)
 		}
@@ -54,3 +204,24 @@ func (rep *baseRepo) Transaction(ctx context.Context, fn func(conn Connection) e
 	}
 	return nil
 }
+
+// runSavepoint runs fn under a savepoint of the outer transaction, a failed fn is rolled back
+// to the savepoint and leaves the outer transaction usable.
+func runSavepoint(ctx context.Context, tx *txConnection, fn func(conn Connection) error) error {
+	nested := &txConnection{Tx: tx.Tx, depth: tx.depth + 1}
+	savepoint := fmt.Sprintf("sp_%d", nested.depth)
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	if err := fn(nested); err != nil {
+		if _, spErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); spErr != nil {
+			return errors.Wrapf(err, "savepoint error %+v with err:", spErr)
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
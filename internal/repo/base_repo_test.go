@@ -0,0 +1,307 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeConnector opens connections whose commits fail with the queued errors.
+type fakeConnector struct {
+	commitErrs []error
+	begins     []driver.TxOptions
+	queries    []string
+	// queries executed outside of a transaction
+	plainQueries []string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+	inTx      bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.connector.begins = append(c.connector.begins, opts)
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.inTx = false
+	if len(c.connector.commitErrs) == 0 {
+		return nil
+	}
+
+	err := c.connector.commitErrs[0]
+	c.connector.commitErrs = c.connector.commitErrs[1:]
+	return err
+}
+
+func (c *fakeConn) Rollback() error {
+	c.inTx = false
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext returns a single method row.
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.record(query)
+	return &fakeRows{}, nil
+}
+
+func (c *fakeConn) record(query string) {
+	if c.inTx {
+		c.connector.queries = append(c.connector.queries, query)
+	} else {
+		c.connector.plainQueries = append(c.connector.plainQueries, query)
+	}
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "user_id", "value", "created_at"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+
+	dest[0], dest[1], dest[2], dest[3] = int64(1), int64(1), "value", time.Time{}
+	return nil
+}
+
+func TestTransactionRetry(t *testing.T) {
+	serializationErr := pgx.PgError{Code: "40001"}
+	uniqueErr := pgx.PgError{Code: "23505"}
+
+	testCases := []struct {
+		commitErrs       []error
+		opts             []TxOption
+		expectedErr      error
+		expectedAttempts int
+	}{
+		{
+			commitErrs:       nil,
+			expectedAttempts: 1,
+		},
+		{
+			commitErrs:       []error{serializationErr, serializationErr},
+			expectedAttempts: 3,
+		},
+		{
+			commitErrs:       []error{serializationErr, serializationErr, serializationErr},
+			expectedErr:      serializationErr,
+			expectedAttempts: 3,
+		},
+		{
+			commitErrs:       []error{serializationErr},
+			opts:             []TxOption{WithMaxAttempts(1)},
+			expectedErr:      serializationErr,
+			expectedAttempts: 1,
+		},
+		{
+			commitErrs:       []error{uniqueErr},
+			expectedErr:      uniqueErr,
+			expectedAttempts: 1,
+		},
+	}
+
+	for index, testCase := range testCases {
+		connector := &fakeConnector{commitErrs: testCase.commitErrs}
+		rep := NewMethodRepo(sqlx.NewDb(sql.OpenDB(connector), "fake"))
+
+		attempts := 0
+		err := rep.Transaction(context.Background(), func(rep MethodRepo) error {
+			attempts++
+			return nil
+		}, testCase.opts...)
+
+		if err != testCase.expectedErr {
+			t.Errorf("failed testCase[%d], error expected '%v' got '%v'", index, testCase.expectedErr, err)
+		}
+		if attempts != testCase.expectedAttempts {
+			t.Errorf("failed testCase[%d], expected %d attempts got %d", index, testCase.expectedAttempts, attempts)
+		}
+	}
+}
+
+func TestTransactionOptions(t *testing.T) {
+	connector := &fakeConnector{}
+	rep := NewMethodRepo(sqlx.NewDb(sql.OpenDB(connector), "fake"))
+
+	err := rep.Transaction(context.Background(), func(rep MethodRepo) error {
+		return nil
+	}, WithTxOptions(&sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}))
+
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	expected := driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable), ReadOnly: true}
+	if len(connector.begins) != 1 || connector.begins[0] != expected {
+		t.Errorf("expected tx options %+v got %+v", expected, connector.begins)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	innerErr := fmt.Errorf("inner error")
+
+	testCases := []struct {
+		fn              func(rep MethodRepo) error
+		expectedQueries []string
+	}{
+		{
+			fn: func(rep MethodRepo) error {
+				return rep.Transaction(context.Background(), func(rep MethodRepo) error {
+					return rep.Transaction(context.Background(), func(rep MethodRepo) error {
+						return nil
+					})
+				})
+			},
+			expectedQueries: []string{
+				"SAVEPOINT sp_1",
+				"SAVEPOINT sp_2",
+				"RELEASE SAVEPOINT sp_2",
+				"RELEASE SAVEPOINT sp_1",
+			},
+		},
+		{
+			fn: func(rep MethodRepo) error {
+				err := rep.Transaction(context.Background(), func(rep MethodRepo) error {
+					return innerErr
+				})
+				if err != innerErr {
+					return fmt.Errorf("unexpected inner error: %v", err)
+				}
+				return nil
+			},
+			expectedQueries: []string{
+				"SAVEPOINT sp_1",
+				"ROLLBACK TO SAVEPOINT sp_1",
+			},
+		},
+	}
+
+	for index, testCase := range testCases {
+		connector := &fakeConnector{}
+		rep := NewMethodRepo(sqlx.NewDb(sql.OpenDB(connector), "fake"))
+
+		if err := rep.Transaction(context.Background(), testCase.fn); err != nil {
+			t.Errorf("failed testCase[%d], unexpected error '%v'", index, err)
+		}
+		if len(connector.begins) != 1 {
+			t.Errorf("failed testCase[%d], expected 1 transaction got %d", index, len(connector.begins))
+		}
+		if !reflect.DeepEqual(connector.queries, testCase.expectedQueries) {
+			t.Errorf("failed testCase[%d], expected queries %v got %v", index, testCase.expectedQueries, connector.queries)
+		}
+	}
+}
+
+// deadlineConn records the time left until the context deadline of the executed queries.
+type deadlineConn struct {
+	Connection
+
+	timeouts []time.Duration
+}
+
+func (c *deadlineConn) record(ctx context.Context) {
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline).Round(time.Second)
+	}
+	c.timeouts = append(c.timeouts, timeout)
+}
+
+func (c *deadlineConn) ExecContext(ctx context.Context, _ string, _ ...interface{}) (sql.Result, error) {
+	c.record(ctx)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *deadlineConn) GetContext(ctx context.Context, _ interface{}, _ string, _ ...interface{}) error {
+	c.record(ctx)
+	return nil
+}
+
+func (c *deadlineConn) SelectContext(ctx context.Context, _ interface{}, _ string, _ ...interface{}) error {
+	c.record(ctx)
+	return nil
+}
+
+// deadlineTxConn records the time left until the context deadline of the started transactions.
+type deadlineTxConn struct {
+	*sqlx.DB
+
+	deadlines *deadlineConn
+}
+
+func (c *deadlineTxConn) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	c.deadlines.record(ctx)
+	return c.DB.BeginTxx(ctx, opts)
+}
+
+func TestMethodRepoTimeouts(t *testing.T) {
+	conn := &deadlineConn{}
+	rep := NewMethodRepo(conn, WithTimeouts(Timeouts{Read: 10 * time.Second, Write: 20 * time.Second}))
+
+	_, _ = rep.List(context.Background(), 10, 0)
+	_, _ = rep.Update(context.Background(), 1, "value")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = rep.Remove(ctx, 1)
+
+	_, _ = NewMethodRepo(conn).Remove(context.Background(), 1)
+
+	txConn := &deadlineTxConn{DB: sqlx.NewDb(sql.OpenDB(&fakeConnector{}), "fake"), deadlines: conn}
+	txRep := NewMethodRepo(txConn, WithTimeouts(Timeouts{Write: 20 * time.Second}))
+	noop := func(MethodRepo) error { return nil }
+	_ = txRep.Transaction(context.Background(), noop)
+	_ = txRep.Transaction(ctx, noop)
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 5 * time.Second, 0, 20 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(conn.timeouts, expected) {
+		t.Errorf("expected timeouts %v got %v", expected, conn.timeouts)
+	}
+}
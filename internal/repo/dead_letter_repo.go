@@ -0,0 +1,183 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+
+	"ova-method-api/internal/model"
+)
+
+//go:generate mockgen -source=$GOFILE -destination=./mock/dead_letter_repo.go -package=mock
+
+type DeadLetterRepo interface {
+	Add(ctx context.Context, letter model.DeadLetter) error
+	// ListDue returns letters scheduled before the given time with less than maxAttempts attempts.
+	// A zero before or maxAttempts disables the corresponding filter.
+	ListDue(ctx context.Context, before time.Time, maxAttempts uint, limit uint64) ([]model.DeadLetter, error)
+	// ListAfter returns letters with an id greater than afterId ordered by id.
+	ListAfter(ctx context.Context, afterId uint64, limit uint64) ([]model.DeadLetter, error)
+	ListByIds(ctx context.Context, ids []uint64) ([]model.DeadLetter, error)
+	Reschedule(ctx context.Context, id uint64, attempts uint, nextAttemptAt time.Time, errMsg string) error
+	Remove(ctx context.Context, id uint64) error
+}
+
+type deadLetterRepo struct {
+	baseRepo
+}
+
+func NewDeadLetterRepo(conn Connection) DeadLetterRepo {
+	return &deadLetterRepo{newBaseRepo(conn)}
+}
+
+func (rep *deadLetterRepo) Add(ctx context.Context, letter model.DeadLetter) error {
+	query, args, err := squirrel.
+		Insert("dead_letters").
+		Columns("topic", "key", "headers", "payload", "error", "attempts", "next_attempt_at").
+		Values(
+			letter.Topic,
+			letter.Key,
+			letter.Headers,
+			letter.Payload,
+			letter.Error,
+			letter.Attempts,
+			letter.NextAttemptAt,
+		).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rep.connection(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (rep *deadLetterRepo) ListDue(
+	ctx context.Context,
+	before time.Time,
+	maxAttempts uint,
+	limit uint64,
+) ([]model.DeadLetter, error) {
+	builder := squirrel.
+		Select("*").
+		From("dead_letters").
+		OrderBy("next_attempt_at asc").
+		Limit(limit).
+		PlaceholderFormat(squirrel.Dollar)
+
+	if !before.IsZero() {
+		builder = builder.Where(squirrel.LtOrEq{"next_attempt_at": before})
+	}
+	if maxAttempts > 0 {
+		builder = builder.Where(squirrel.Lt{"attempts": maxAttempts})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.DeadLetter
+	if err = rep.connection(ctx).SelectContext(ctx, &result, query, args...); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (rep *deadLetterRepo) ListAfter(ctx context.Context, afterId uint64, limit uint64) ([]model.DeadLetter, error) {
+	query, args, err := squirrel.
+		Select("*").
+		From("dead_letters").
+		Where(squirrel.Gt{"id": afterId}).
+		OrderBy("id asc").
+		Limit(limit).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.DeadLetter
+	if err = rep.connection(ctx).SelectContext(ctx, &result, query, args...); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (rep *deadLetterRepo) ListByIds(ctx context.Context, ids []uint64) ([]model.DeadLetter, error) {
+	query, args, err := squirrel.
+		Select("*").
+		From("dead_letters").
+		Where(squirrel.Eq{"id": ids}).
+		OrderBy("id asc").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.DeadLetter
+	if err = rep.connection(ctx).SelectContext(ctx, &result, query, args...); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (rep *deadLetterRepo) Reschedule(
+	ctx context.Context,
+	id uint64,
+	attempts uint,
+	nextAttemptAt time.Time,
+	errMsg string,
+) error {
+	query, args, err := squirrel.
+		Update("dead_letters").
+		Set("attempts", attempts).
+		Set("next_attempt_at", nextAttemptAt).
+		Set("error", errMsg).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	res, err := rep.connection(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return ErrNoRowAffected
+	}
+
+	return nil
+}
+
+func (rep *deadLetterRepo) Remove(ctx context.Context, id uint64) error {
+	query, args, err := squirrel.
+		Delete("dead_letters").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rep.connection(ctx).ExecContext(ctx, query, args...)
+	return err
+}
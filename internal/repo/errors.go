@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+type sqlStateError interface {
+	SQLState() string
+}
+
+// IsTransient reports whether the failed operation may succeed if it is retried:
+// connection problems, serialization failures, deadlocks and server shutdowns.
+// Constraint violations, syntax errors and unknown errors are treated as permanent.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		return isTransientSQLState(stateErr.SQLState())
+	}
+
+	return false
+}
+
+// IsSerializationFailure reports whether the transaction was aborted by a serialization failure
+// or a deadlock, such a transaction may succeed if it is run again from the start.
+func IsSerializationFailure(err error) bool {
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		code := stateErr.SQLState()
+		return code == "40001" || code == "40P01"
+	}
+	return false
+}
+
+// IsTimeout reports whether the operation was stopped by the context deadline
+// or the query was canceled by the database, e.g. by the statement timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		// query canceled
+		return stateErr.SQLState() == "57014"
+	}
+	return false
+}
+
+func isTransientSQLState(code string) bool {
+	switch {
+	// connection exception
+	case strings.HasPrefix(code, "08"):
+		return true
+	// serialization failure, deadlock detected
+	case code == "40001" || code == "40P01":
+		return true
+	// insufficient resources
+	case strings.HasPrefix(code, "53"):
+		return true
+	// admin shutdown, crash shutdown, cannot connect now
+	case code == "57P01" || code == "57P02" || code == "57P03":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: fmt.Errorf("unknown"), expected: false},
+		{err: driver.ErrBadConn, expected: true},
+		{err: errors.Wrap(driver.ErrBadConn, "wrapped"), expected: true},
+		{err: pgx.PgError{Code: "40001"}, expected: true},
+		{err: pgx.PgError{Code: "40P01"}, expected: true},
+		{err: pgx.PgError{Code: "08006"}, expected: true},
+		{err: pgx.PgError{Code: "23505"}, expected: false},
+		{err: pgx.PgError{Code: "42601"}, expected: false},
+	}
+
+	for index, testCase := range testCases {
+		if result := IsTransient(testCase.err); result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
+
+func TestIsSerializationFailure(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: driver.ErrBadConn, expected: false},
+		{err: pgx.PgError{Code: "40001"}, expected: true},
+		{err: errors.Wrap(pgx.PgError{Code: "40P01"}, "wrapped"), expected: true},
+		{err: pgx.PgError{Code: "08006"}, expected: false},
+	}
+
+	for index, testCase := range testCases {
+		if result := IsSerializationFailure(testCase.err); result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: context.Canceled, expected: false},
+		{err: context.DeadlineExceeded, expected: true},
+		{err: errors.Wrap(context.DeadlineExceeded, "wrapped"), expected: true},
+		{err: pgx.PgError{Code: "57014"}, expected: true},
+		{err: pgx.PgError{Code: "40001"}, expected: false},
+	}
+
+	for index, testCase := range testCases {
+		if result := IsTimeout(testCase.err); result != testCase.expected {
+			t.Errorf("failed testCase[%d], expected %v got %v", index, testCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"ova-method-api/internal/model"
+)
+
+// memoryStore keeps methods sorted by id, lastId is the id sequence and, as in postgres,
+// isn't rolled back with a transaction.
+type memoryStore struct {
+	mu      sync.RWMutex
+	methods []model.Method
+	lastId  uint64
+}
+
+// memoryMethodRepo keeps methods in memory. A transaction holds the store exclusively until it ends,
+// so transactions are serializable; calling the outer repository inside fn blocks until fn returns.
+type memoryMethodRepo struct {
+	store *memoryStore
+	// inTx is set for the repository passed to the transaction fn, which already holds the store lock
+	inTx bool
+}
+
+func NewMemoryMethodRepo() MethodRepo {
+	return &memoryMethodRepo{store: &memoryStore{}}
+}
+
+func (rep *memoryMethodRepo) lock() func() {
+	if rep.inTx {
+		return func() {}
+	}
+	rep.store.mu.Lock()
+	return rep.store.mu.Unlock
+}
+
+func (rep *memoryMethodRepo) rLock() func() {
+	if rep.inTx {
+		return func() {}
+	}
+	rep.store.mu.RLock()
+	return rep.store.mu.RUnlock
+}
+
+// Transaction runs fn on a snapshot of the methods, which replaces the changes of the failed fn.
+// Inside another transaction the snapshot acts as a savepoint. Tx options are ignored.
+func (rep *memoryMethodRepo) Transaction(ctx context.Context, fn func(rep MethodRepo) error, _ ...TxOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock := rep.lock()
+	defer unlock()
+
+	snapshot := make([]model.Method, len(rep.store.methods))
+	copy(snapshot, rep.store.methods)
+
+	if err := fn(&memoryMethodRepo{store: rep.store, inTx: true}); err != nil {
+		rep.store.methods = snapshot
+		return err
+	}
+	return nil
+}
+
+func (rep *memoryMethodRepo) Add(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := rep.lock()
+	defer unlock()
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+
+	result := make([]model.Method, 0, len(items))
+	for _, item := range items {
+		rep.store.lastId++
+		result = append(result, model.Method{
+			Id:        rep.store.lastId,
+			UserId:    item.UserId,
+			Value:     item.Value,
+			CreatedAt: createdAt,
+		})
+	}
+	rep.store.methods = append(rep.store.methods, result...)
+
+	return result, nil
+}
+
+func (rep *memoryMethodRepo) BulkAdd(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	return rep.Add(ctx, items)
+}
+
+func (rep *memoryMethodRepo) Update(ctx context.Context, id uint64, value string) (*model.Method, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := rep.lock()
+	defer unlock()
+
+	index, ok := rep.store.find(id)
+	if !ok {
+		return nil, ErrNoRowAffected
+	}
+	rep.store.methods[index].Value = value
+
+	result := rep.store.methods[index]
+	return &result, nil
+}
+
+func (rep *memoryMethodRepo) Remove(ctx context.Context, id uint64) (*model.Method, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := rep.lock()
+	defer unlock()
+
+	index, ok := rep.store.find(id)
+	if !ok {
+		return nil, ErrNoRowAffected
+	}
+
+	result := rep.store.methods[index]
+	rep.store.methods = append(rep.store.methods[:index], rep.store.methods[index+1:]...)
+
+	return &result, nil
+}
+
+func (rep *memoryMethodRepo) List(ctx context.Context, limit, offset uint64) ([]model.Method, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := rep.rLock()
+	defer unlock()
+
+	total := uint64(len(rep.store.methods))
+	if offset >= total || limit == 0 {
+		return nil, nil
+	}
+
+	end := total
+	if limit < total-offset {
+		end = offset + limit
+	}
+
+	result := make([]model.Method, end-offset)
+	copy(result, rep.store.methods[offset:end])
+
+	return result, nil
+}
+
+func (rep *memoryMethodRepo) Describe(ctx context.Context, id uint64) (*model.Method, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := rep.rLock()
+	defer unlock()
+
+	index, ok := rep.store.find(id)
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	method := rep.store.methods[index]
+	return &method, nil
+}
+
+func (store *memoryStore) find(id uint64) (int, bool) {
+	index := sort.Search(len(store.methods), func(i int) bool {
+		return store.methods[i].Id >= id
+	})
+	return index, index < len(store.methods) && store.methods[index].Id == id
+}
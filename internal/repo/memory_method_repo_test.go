@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"ova-method-api/internal/model"
+)
+
+func TestMemoryMethodRepoConformance(t *testing.T) {
+	testMethodRepoConformance(t, func(t *testing.T) MethodRepo {
+		return NewMemoryMethodRepo()
+	})
+}
+
+func TestMemoryMethodRepoConcurrentAdd(t *testing.T) {
+	rep := NewMemoryMethodRepo()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, _ = rep.Add(context.Background(), []model.Method{{UserId: 1, Value: "value"}})
+				_, _ = rep.List(context.Background(), 10, 0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	methods, err := rep.List(context.Background(), 1000, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(methods) != 100 {
+		t.Fatalf("expected 100 methods, got %d", len(methods))
+	}
+	for i, method := range methods {
+		if method.Id != uint64(i+1) {
+			t.Fatalf("expected unique ascending ids, got %d at %d", method.Id, i)
+		}
+	}
+}
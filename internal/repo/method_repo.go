@@ -6,13 +6,20 @@ import (
 	"fmt"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/stdlib"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 
 	"ova-method-api/internal/model"
 )
 
 //go:generate mockgen -source=$GOFILE -destination=./mock/method_repo.go -package=mock
 
+// bulkChunkSize keeps the two bind parameters per row under the 65535 limit of postgres
+const bulkChunkSize = 30000
+
 var (
 	ErrNoRows        = fmt.Errorf("no rows in result set")
 	ErrNoRowAffected = fmt.Errorf("no rows affected")
@@ -20,33 +27,41 @@ var (
 
 type MethodRepo interface {
 	Add(ctx context.Context, items []model.Method) ([]model.Method, error)
-	Update(ctx context.Context, id uint64, value string) error
-	Remove(ctx context.Context, id uint64) error
+	// BulkAdd is Add for large batches, which don't fit into the bind parameter limit of a single insert
+	BulkAdd(ctx context.Context, items []model.Method) ([]model.Method, error)
+	// Update and Remove return the changed method, so the caller knows its owner
+	Update(ctx context.Context, id uint64, value string) (*model.Method, error)
+	Remove(ctx context.Context, id uint64) (*model.Method, error)
 	List(ctx context.Context, limit, offset uint64) ([]model.Method, error)
 	Describe(ctx context.Context, id uint64) (*model.Method, error)
-	Transaction(ctx context.Context, fn func(rep MethodRepo) error) error
+	Transaction(ctx context.Context, fn func(rep MethodRepo) error, opts ...TxOption) error
 }
 
 type methodRepo struct {
 	baseRepo
+
+	placeholder squirrel.PlaceholderFormat
 }
 
-func NewMethodRepo(conn Connection) MethodRepo {
-	return &methodRepo{newBaseRepo(conn)}
+func NewMethodRepo(conn Connection, opts ...Option) MethodRepo {
+	return &methodRepo{baseRepo: newBaseRepo(conn, opts...), placeholder: squirrel.Dollar}
 }
 
-func (rep *methodRepo) Transaction(ctx context.Context, fn func(rep MethodRepo) error) error {
+func (rep *methodRepo) Transaction(ctx context.Context, fn func(rep MethodRepo) error, opts ...TxOption) error {
 	return rep.baseRepo.Transaction(ctx, func(conn Connection) error {
-		return fn(NewMethodRepo(conn))
-	})
+		return fn(NewMethodRepo(conn, WithTimeouts(rep.timeouts)))
+	}, opts...)
 }
 
 func (rep *methodRepo) Add(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Write)
+	defer cancel()
+
 	builder := squirrel.
 		Insert("methods").
 		Columns("user_id", "value").
 		Suffix("RETURNING id, user_id, value, created_at").
-		PlaceholderFormat(squirrel.Dollar)
+		PlaceholderFormat(rep.placeholder)
 
 	for _, item := range items {
 		builder = builder.Values(item.UserId, item.Value)
@@ -57,7 +72,7 @@ func (rep *methodRepo) Add(ctx context.Context, items []model.Method) ([]model.M
 		return nil, err
 	}
 
-	rows, err := rep.conn.QueryxContext(ctx, query, args...)
+	rows, err := rep.connection(ctx).QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -85,62 +100,155 @@ func (rep *methodRepo) Add(ctx context.Context, items []model.Method) ([]model.M
 	return result, withCloseRows(nil)
 }
 
-func (rep *methodRepo) Update(ctx context.Context, id uint64, value string) error {
-	query, args, err := squirrel.
-		Update("methods").
-		Set("value", value).
-		Where(squirrel.Eq{"id": id}).
-		PlaceholderFormat(squirrel.Dollar).
-		ToSql()
+// BulkAdd copies items into a temporary staging table and moves them to methods with a single insert.
+// The copy protocol isn't available through a database/sql transaction, so inside Transaction
+// items are inserted by chunks of Add.
+func (rep *methodRepo) BulkAdd(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Bulk)
+	defer cancel()
 
+	db, ok := rep.connection(ctx).(*sqlx.DB)
+	if !ok {
+		return rep.addByChunks(ctx, items)
+	}
+
+	conn, err := stdlib.AcquireConn(db.DB)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer func() {
+		if releaseErr := stdlib.ReleaseConn(db.DB, conn); releaseErr != nil {
+			log.Error().Err(releaseErr).Msg("failed release db connection")
+		}
+	}()
 
-	res, err := rep.conn.ExecContext(ctx, query, args...)
+	tx, err := conn.BeginEx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// rollback after commit is a no-op
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	cnt, err := res.RowsAffected()
+	_, err = tx.ExecEx(ctx, "CREATE TEMP TABLE methods_staging (seq bigint, user_id bigint, value text) ON COMMIT DROP", nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if cnt == 0 {
-		return ErrNoRowAffected
+
+	_, err = tx.CopyFrom(
+		pgx.Identifier{"methods_staging"},
+		[]string{"seq", "user_id", "value"},
+		&methodCopySource{items: items, index: -1},
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	rows, err := tx.QueryEx(ctx, `INSERT INTO methods (user_id, value)
+		SELECT user_id, value FROM methods_staging ORDER BY seq
+		RETURNING id, user_id, value, created_at`, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.Method, 0, len(items))
+	for rows.Next() {
+		var method model.Method
+		if err = rows.Scan(&method.Id, &method.UserId, &method.Value, &method.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result = append(result, method)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.CommitEx(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addByChunks inserts items by chunks of bulkChunkSize rows, so each insert stays under the bind parameter limit.
+func (rep *methodRepo) addByChunks(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	result := make([]model.Method, 0, len(items))
+	for start := 0; start < len(items); start += bulkChunkSize {
+		end := start + bulkChunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		saved, err := rep.Add(ctx, items[start:end])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, saved...)
+	}
+
+	return result, nil
 }
 
-func (rep *methodRepo) Remove(ctx context.Context, id uint64) error {
+func (rep *methodRepo) Update(ctx context.Context, id uint64, value string) (*model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Write)
+	defer cancel()
+
 	query, args, err := squirrel.
-		Delete("methods").
+		Update("methods").
+		Set("value", value).
 		Where(squirrel.Eq{"id": id}).
-		PlaceholderFormat(squirrel.Dollar).
+		Suffix("RETURNING id, user_id, value, created_at").
+		PlaceholderFormat(rep.placeholder).
 		ToSql()
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	res, err := rep.conn.ExecContext(ctx, query, args...)
+	return rep.getChanged(ctx, query, args...)
+}
+
+func (rep *methodRepo) Remove(ctx context.Context, id uint64) (*model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Write)
+	defer cancel()
+
+	query, args, err := squirrel.
+		Delete("methods").
+		Where(squirrel.Eq{"id": id}).
+		Suffix("RETURNING id, user_id, value, created_at").
+		PlaceholderFormat(rep.placeholder).
+		ToSql()
+
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	cnt, err := res.RowsAffected()
-	if err != nil {
-		return err
+	return rep.getChanged(ctx, query, args...)
+}
+
+// getChanged runs the update or the delete query returning the changed method.
+func (rep *methodRepo) getChanged(ctx context.Context, query string, args ...interface{}) (*model.Method, error) {
+	var result model.Method
+	err := rep.connection(ctx).GetContext(ctx, &result, query, args...)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNoRowAffected
 	}
-	if cnt == 0 {
-		return ErrNoRowAffected
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &result, nil
 }
 
 func (rep *methodRepo) List(ctx context.Context, limit, offset uint64) ([]model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Read)
+	defer cancel()
+
 	query, args, err := squirrel.
 		Select("*").
 		From("methods").
@@ -154,7 +262,10 @@ func (rep *methodRepo) List(ctx context.Context, limit, offset uint64) ([]model.
 	}
 
 	var result []model.Method
-	err = rep.conn.SelectContext(ctx, &result, query, args...)
+	err = rep.read(ctx, func(conn Connection) error {
+		result = nil
+		return conn.SelectContext(ctx, &result, query, args...)
+	})
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNoRows
@@ -168,11 +279,14 @@ func (rep *methodRepo) List(ctx context.Context, limit, offset uint64) ([]model.
 }
 
 func (rep *methodRepo) Describe(ctx context.Context, id uint64) (*model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Read)
+	defer cancel()
+
 	query, args, err := squirrel.
 		Select("*").
 		From("methods").
 		Where(squirrel.Eq{"id": id}).
-		PlaceholderFormat(squirrel.Dollar).
+		PlaceholderFormat(rep.placeholder).
 		ToSql()
 
 	if err != nil {
@@ -180,7 +294,9 @@ func (rep *methodRepo) Describe(ctx context.Context, id uint64) (*model.Method,
 	}
 
 	var result model.Method
-	err = rep.conn.GetContext(ctx, &result, query, args...)
+	err = rep.read(ctx, func(conn Connection) error {
+		return conn.GetContext(ctx, &result, query, args...)
+	})
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNoRows
@@ -192,3 +308,23 @@ func (rep *methodRepo) Describe(ctx context.Context, id uint64) (*model.Method,
 
 	return &result, nil
 }
+
+// methodCopySource feeds items to the copy protocol without copying them into rows.
+type methodCopySource struct {
+	items []model.Method
+	index int
+}
+
+func (src *methodCopySource) Next() bool {
+	src.index++
+	return src.index < len(src.items)
+}
+
+func (src *methodCopySource) Values() ([]interface{}, error) {
+	item := src.items[src.index]
+	return []interface{}{int64(src.index), int64(item.UserId), item.Value}, nil
+}
+
+func (src *methodCopySource) Err() error {
+	return nil
+}
@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"ova-method-api/internal/model"
+)
+
+// testMethodRepoConformance checks the behavior shared by all MethodRepo implementations,
+// newRepo returns a repository over an empty storage.
+func testMethodRepoConformance(t *testing.T, newRepo func(t *testing.T) MethodRepo) {
+	ctx := context.Background()
+	failure := fmt.Errorf("failure")
+
+	add := func(t *testing.T, rep MethodRepo, values ...string) []model.Method {
+		t.Helper()
+		items := make([]model.Method, 0, len(values))
+		for i, value := range values {
+			items = append(items, model.Method{UserId: uint64(i + 1), Value: value})
+		}
+
+		saved, err := rep.Add(ctx, items)
+		if err != nil {
+			t.Fatalf("failed add: %v", err)
+		}
+		return saved
+	}
+
+	assertValues := func(t *testing.T, methods []model.Method, values ...string) {
+		t.Helper()
+		if len(methods) != len(values) {
+			t.Fatalf("expected values %v, got %v", values, methods)
+		}
+		for i, method := range methods {
+			if method.Value != values[i] {
+				t.Errorf("expected values %v, got %v", values, methods)
+			}
+		}
+	}
+
+	listAll := func(t *testing.T, rep MethodRepo) []model.Method {
+		t.Helper()
+		methods, err := rep.List(ctx, 100, 0)
+		if err != nil {
+			t.Fatalf("failed list: %v", err)
+		}
+		return methods
+	}
+
+	t.Run("add assigns ascending ids", func(t *testing.T) {
+		rep := newRepo(t)
+		saved := add(t, rep, "first", "second")
+		saved = append(saved, add(t, rep, "third")...)
+
+		assertValues(t, saved, "first", "second", "third")
+		for i, method := range saved {
+			if method.UserId == 0 || method.CreatedAt.IsZero() || (i > 0 && method.Id <= saved[i-1].Id) {
+				t.Errorf("unexpected saved method %s", method.String())
+			}
+		}
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		rep := newRepo(t)
+		saved := add(t, rep, "first")
+
+		method, err := rep.Describe(ctx, saved[0].Id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if method.Id != saved[0].Id || method.UserId != saved[0].UserId || method.Value != "first" {
+			t.Errorf("expected %s got %s", saved[0].String(), method.String())
+		}
+
+		if _, err = rep.Describe(ctx, saved[0].Id+1); err != ErrNoRows {
+			t.Errorf("expected %v got %v", ErrNoRows, err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rep := newRepo(t)
+		saved := add(t, rep, "first", "second")
+
+		updated, err := rep.Update(ctx, saved[1].Id, "updated")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated.Id != saved[1].Id || updated.UserId != saved[1].UserId || updated.Value != "updated" {
+			t.Errorf("expected the updated method %s got %s", saved[1].String(), updated.String())
+		}
+		assertValues(t, listAll(t, rep), "first", "updated")
+
+		if _, err = rep.Update(ctx, saved[1].Id+1, "missing"); err != ErrNoRowAffected {
+			t.Errorf("expected %v got %v", ErrNoRowAffected, err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		rep := newRepo(t)
+		saved := add(t, rep, "first", "second", "third")
+
+		removed, err := rep.Remove(ctx, saved[1].Id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if removed.Id != saved[1].Id || removed.UserId != saved[1].UserId || removed.Value != "second" {
+			t.Errorf("expected the removed method %s got %s", saved[1].String(), removed.String())
+		}
+		assertValues(t, listAll(t, rep), "first", "third")
+
+		if _, err = rep.Remove(ctx, saved[1].Id); err != ErrNoRowAffected {
+			t.Errorf("expected %v got %v", ErrNoRowAffected, err)
+		}
+		if _, err := rep.Describe(ctx, saved[1].Id); err != ErrNoRows {
+			t.Errorf("expected %v got %v", ErrNoRows, err)
+		}
+	})
+
+	t.Run("list pages", func(t *testing.T) {
+		rep := newRepo(t)
+		add(t, rep, "first", "second", "third", "fourth", "fifth")
+
+		testCases := []struct {
+			limit, offset uint64
+			expected      []string
+		}{
+			{limit: 2, offset: 0, expected: []string{"first", "second"}},
+			{limit: 2, offset: 2, expected: []string{"third", "fourth"}},
+			{limit: 2, offset: 4, expected: []string{"fifth"}},
+			{limit: 2, offset: 5, expected: []string{}},
+			{limit: 10, offset: 1, expected: []string{"second", "third", "fourth", "fifth"}},
+		}
+
+		for _, testCase := range testCases {
+			methods, err := rep.List(ctx, testCase.limit, testCase.offset)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertValues(t, methods, testCase.expected...)
+		}
+	})
+
+	t.Run("bulk add", func(t *testing.T) {
+		rep := newRepo(t)
+		items := make([]model.Method, 100)
+		values := make([]string, len(items))
+		for i := range items {
+			values[i] = fmt.Sprintf("bulk-%d", i)
+			items[i] = model.Method{UserId: uint64(i + 1), Value: values[i]}
+		}
+
+		saved, err := rep.BulkAdd(ctx, items)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertValues(t, saved, values...)
+		assertValues(t, listAll(t, rep), values...)
+	})
+
+	t.Run("transaction commits", func(t *testing.T) {
+		rep := newRepo(t)
+		add(t, rep, "first")
+
+		err := rep.Transaction(ctx, func(tx MethodRepo) error {
+			add(t, tx, "second")
+			assertValues(t, listAll(t, tx), "first", "second")
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertValues(t, listAll(t, rep), "first", "second")
+	})
+
+	t.Run("transaction rolls back", func(t *testing.T) {
+		rep := newRepo(t)
+		saved := add(t, rep, "first", "second")
+
+		err := rep.Transaction(ctx, func(tx MethodRepo) error {
+			add(t, tx, "third")
+			if _, err := tx.Update(ctx, saved[0].Id, "updated"); err != nil {
+				return err
+			}
+			if _, err := tx.Remove(ctx, saved[1].Id); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("expected %v got %v", failure, err)
+		}
+		assertValues(t, listAll(t, rep), "first", "second")
+	})
+
+	t.Run("nested transaction rolls back to savepoint", func(t *testing.T) {
+		rep := newRepo(t)
+
+		err := rep.Transaction(ctx, func(tx MethodRepo) error {
+			add(t, tx, "kept")
+
+			nestedErr := tx.Transaction(ctx, func(nested MethodRepo) error {
+				add(t, nested, "rolled back")
+				return failure
+			})
+			if nestedErr != failure {
+				return fmt.Errorf("expected nested failure, got %v", nestedErr)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertValues(t, listAll(t, rep), "kept")
+	})
+}
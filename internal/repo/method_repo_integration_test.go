@@ -0,0 +1,109 @@
+//go:build integration
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"ova-method-api/internal/model"
+	"ova-method-api/internal/testdb"
+)
+
+func TestBulkAddIntegration(t *testing.T) {
+	db, err := testdb.Start("../../migrations")
+	if err != nil {
+		t.Fatalf("failed start test database: %v", err)
+	}
+	defer db.Close()
+
+	items := []model.Method{{UserId: 1, Value: "first"}, {UserId: 2, Value: "second"}, {UserId: 3, Value: "third"}}
+	rep := NewMethodRepo(db.DB)
+
+	assertSaved := func(t *testing.T, saved []model.Method) {
+		if len(saved) != len(items) {
+			t.Fatalf("expected %d saved methods, got %d", len(items), len(saved))
+		}
+		for i, method := range saved {
+			if method.Id == 0 || method.UserId != items[i].UserId || method.Value != items[i].Value {
+				t.Errorf("method[%d] %s doesn't match %s", i, method.String(), items[i].String())
+			}
+		}
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		saved, err := rep.BulkAdd(context.Background(), items)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertSaved(t, saved)
+	})
+
+	t.Run("inside transaction", func(t *testing.T) {
+		var saved []model.Method
+		err := rep.Transaction(context.Background(), func(rep MethodRepo) error {
+			var err error
+			saved, err = rep.BulkAdd(context.Background(), items)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertSaved(t, saved)
+	})
+}
+
+func TestNestedTransactionIntegration(t *testing.T) {
+	db, err := testdb.Start("../../migrations")
+	if err != nil {
+		t.Fatalf("failed start test database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	innerErr := fmt.Errorf("inner error")
+
+	err = NewMethodRepo(db.DB).Transaction(ctx, func(rep MethodRepo) error {
+		if _, err := rep.Add(ctx, []model.Method{{UserId: 1, Value: "outer"}}); err != nil {
+			return err
+		}
+
+		err := rep.Transaction(ctx, func(rep MethodRepo) error {
+			if _, err := rep.Add(ctx, []model.Method{{UserId: 1, Value: "inner"}}); err != nil {
+				return err
+			}
+			return innerErr
+		})
+		if err != innerErr {
+			return fmt.Errorf("unexpected inner error: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var values []string
+	if err = db.Select(&values, "SELECT value FROM methods ORDER BY id"); err != nil {
+		t.Fatalf("failed select methods: %v", err)
+	}
+	if len(values) != 1 || values[0] != "outer" {
+		t.Errorf("expected only the outer method, got %v", values)
+	}
+}
+
+func TestMethodRepoConformanceIntegration(t *testing.T) {
+	db, err := testdb.Start("../../migrations")
+	if err != nil {
+		t.Fatalf("failed start test database: %v", err)
+	}
+	defer db.Close()
+
+	testMethodRepoConformance(t, func(t *testing.T) MethodRepo {
+		if err := db.Truncate("methods"); err != nil {
+			t.Fatalf("failed truncate methods: %v", err)
+		}
+		return NewMethodRepo(db.DB)
+	})
+}
@@ -0,0 +1,124 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: dead_letter_repo.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	model "ova-method-api/internal/model"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockDeadLetterRepo is a mock of DeadLetterRepo interface.
+type MockDeadLetterRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterRepoMockRecorder
+}
+
+// MockDeadLetterRepoMockRecorder is the mock recorder for MockDeadLetterRepo.
+type MockDeadLetterRepoMockRecorder struct {
+	mock *MockDeadLetterRepo
+}
+
+// NewMockDeadLetterRepo creates a new mock instance.
+func NewMockDeadLetterRepo(ctrl *gomock.Controller) *MockDeadLetterRepo {
+	mock := &MockDeadLetterRepo{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterRepo) EXPECT() *MockDeadLetterRepoMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockDeadLetterRepo) Add(ctx context.Context, letter model.DeadLetter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", ctx, letter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockDeadLetterRepoMockRecorder) Add(ctx, letter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockDeadLetterRepo)(nil).Add), ctx, letter)
+}
+
+// ListAfter mocks base method.
+func (m *MockDeadLetterRepo) ListAfter(ctx context.Context, afterId, limit uint64) ([]model.DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAfter", ctx, afterId, limit)
+	ret0, _ := ret[0].([]model.DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAfter indicates an expected call of ListAfter.
+func (mr *MockDeadLetterRepoMockRecorder) ListAfter(ctx, afterId, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAfter", reflect.TypeOf((*MockDeadLetterRepo)(nil).ListAfter), ctx, afterId, limit)
+}
+
+// ListByIds mocks base method.
+func (m *MockDeadLetterRepo) ListByIds(ctx context.Context, ids []uint64) ([]model.DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByIds", ctx, ids)
+	ret0, _ := ret[0].([]model.DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByIds indicates an expected call of ListByIds.
+func (mr *MockDeadLetterRepoMockRecorder) ListByIds(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByIds", reflect.TypeOf((*MockDeadLetterRepo)(nil).ListByIds), ctx, ids)
+}
+
+// ListDue mocks base method.
+func (m *MockDeadLetterRepo) ListDue(ctx context.Context, before time.Time, maxAttempts uint, limit uint64) ([]model.DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDue", ctx, before, maxAttempts, limit)
+	ret0, _ := ret[0].([]model.DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDue indicates an expected call of ListDue.
+func (mr *MockDeadLetterRepoMockRecorder) ListDue(ctx, before, maxAttempts, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDue", reflect.TypeOf((*MockDeadLetterRepo)(nil).ListDue), ctx, before, maxAttempts, limit)
+}
+
+// Remove mocks base method.
+func (m *MockDeadLetterRepo) Remove(ctx context.Context, id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockDeadLetterRepoMockRecorder) Remove(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockDeadLetterRepo)(nil).Remove), ctx, id)
+}
+
+// Reschedule mocks base method.
+func (m *MockDeadLetterRepo) Reschedule(ctx context.Context, id uint64, attempts uint, nextAttemptAt time.Time, errMsg string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reschedule", ctx, id, attempts, nextAttemptAt, errMsg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reschedule indicates an expected call of Reschedule.
+func (mr *MockDeadLetterRepoMockRecorder) Reschedule(ctx, id, attempts, nextAttemptAt, errMsg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reschedule", reflect.TypeOf((*MockDeadLetterRepo)(nil).Reschedule), ctx, id, attempts, nextAttemptAt, errMsg)
+}
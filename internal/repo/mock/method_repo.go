@@ -51,6 +51,21 @@ func (mr *MockMethodRepoMockRecorder) Add(ctx, items interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockMethodRepo)(nil).Add), ctx, items)
 }
 
+// BulkAdd mocks base method.
+func (m *MockMethodRepo) BulkAdd(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkAdd", ctx, items)
+	ret0, _ := ret[0].([]model.Method)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkAdd indicates an expected call of BulkAdd.
+func (mr *MockMethodRepoMockRecorder) BulkAdd(ctx, items interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkAdd", reflect.TypeOf((*MockMethodRepo)(nil).BulkAdd), ctx, items)
+}
+
 // Describe mocks base method.
 func (m *MockMethodRepo) Describe(ctx context.Context, id uint64) (*model.Method, error) {
 	m.ctrl.T.Helper()
@@ -82,11 +97,12 @@ func (mr *MockMethodRepoMockRecorder) List(ctx, limit, offset interface{}) *gomo
 }
 
 // Remove mocks base method.
-func (m *MockMethodRepo) Remove(ctx context.Context, id uint64) error {
+func (m *MockMethodRepo) Remove(ctx context.Context, id uint64) (*model.Method, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Remove", ctx, id)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*model.Method)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Remove indicates an expected call of Remove.
@@ -96,25 +112,31 @@ func (mr *MockMethodRepoMockRecorder) Remove(ctx, id interface{}) *gomock.Call {
 }
 
 // Transaction mocks base method.
-func (m *MockMethodRepo) Transaction(ctx context.Context, fn func(repo.MethodRepo) error) error {
+func (m *MockMethodRepo) Transaction(ctx context.Context, fn func(repo.MethodRepo) error, opts ...repo.TxOption) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Transaction", ctx, fn)
+	varargs := []interface{}{ctx, fn}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Transaction", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Transaction indicates an expected call of Transaction.
-func (mr *MockMethodRepoMockRecorder) Transaction(ctx, fn interface{}) *gomock.Call {
+func (mr *MockMethodRepoMockRecorder) Transaction(ctx, fn interface{}, opts ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transaction", reflect.TypeOf((*MockMethodRepo)(nil).Transaction), ctx, fn)
+	varargs := append([]interface{}{ctx, fn}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transaction", reflect.TypeOf((*MockMethodRepo)(nil).Transaction), varargs...)
 }
 
 // Update mocks base method.
-func (m *MockMethodRepo) Update(ctx context.Context, id uint64, value string) error {
+func (m *MockMethodRepo) Update(ctx context.Context, id uint64, value string) (*model.Method, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Update", ctx, id, value)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*model.Method)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Update indicates an expected call of Update.
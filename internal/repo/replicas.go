@@ -0,0 +1,131 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReplicaConnection is a read replica which can be health checked.
+type ReplicaConnection interface {
+	Connection
+
+	PingContext(ctx context.Context) error
+}
+
+// Replicas routes reads to healthy replicas in round-robin order.
+// Replicas are pinged periodically, a replica marked down returns after a successful ping.
+type Replicas interface {
+	// Next returns the next healthy replica, ok is false when all replicas are down.
+	Next() (conn Connection, ok bool)
+	MarkDown(conn Connection)
+	Close()
+}
+
+type replica struct {
+	conn    ReplicaConnection
+	healthy atomic.Bool
+}
+
+type replicas struct {
+	replicas []*replica
+	next     atomic.Uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+	checkDone chan struct{}
+}
+
+func NewReplicas(conns []ReplicaConnection, checkInterval, checkTimeout time.Duration) Replicas {
+	set := &replicas{
+		replicas:  make([]*replica, 0, len(conns)),
+		done:      make(chan struct{}),
+		checkDone: make(chan struct{}),
+	}
+
+	for _, conn := range conns {
+		r := &replica{conn: conn}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+
+	go set.runHealthCheck(checkInterval, checkTimeout)
+
+	return set
+}
+
+func (set *replicas) Next() (Connection, bool) {
+	count := uint64(len(set.replicas))
+	for i := uint64(0); i < count; i++ {
+		r := set.replicas[set.next.Add(1)%count]
+		if r.healthy.Load() {
+			return r.conn, true
+		}
+	}
+
+	return nil, false
+}
+
+func (set *replicas) MarkDown(conn Connection) {
+	for _, r := range set.replicas {
+		if r.conn == conn {
+			r.healthy.Store(false)
+		}
+	}
+}
+
+func (set *replicas) Close() {
+	set.closeOnce.Do(func() {
+		close(set.done)
+	})
+	<-set.checkDone
+}
+
+func (set *replicas) runHealthCheck(interval, timeout time.Duration) {
+	defer close(set.checkDone)
+
+	if len(set.replicas) == 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		set.check(timeout)
+
+		select {
+		case <-ticker.C:
+		case <-set.done:
+			return
+		}
+	}
+}
+
+func (set *replicas) check(timeout time.Duration) {
+	for index, r := range set.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.conn.PingContext(ctx)
+		cancel()
+
+		if healthy := err == nil; r.healthy.Swap(healthy) != healthy {
+			log.Warn().Err(err).Int("replica", index).Bool("healthy", healthy).Msg("replica health changed")
+		}
+	}
+}
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites makes reads with the returned context go to the primary,
+// so they observe the writes made just before them.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func isReadYourWrites(ctx context.Context) bool {
+	value, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return value
+}
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeReadConn records reads; the methods not used by the tests panic through the nil Connection.
+type fakeReadConn struct {
+	Connection
+
+	name    string
+	reads   *[]string
+	readErr error
+	down    atomic.Bool
+}
+
+func (c *fakeReadConn) SelectContext(context.Context, interface{}, string, ...interface{}) error {
+	*c.reads = append(*c.reads, c.name)
+	return c.readErr
+}
+
+func (c *fakeReadConn) PingContext(context.Context) error {
+	if c.down.Load() {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestReplicasRoundRobin(t *testing.T) {
+	var reads []string
+	first := &fakeReadConn{name: "first", reads: &reads}
+	second := &fakeReadConn{name: "second", reads: &reads}
+
+	replicas := NewReplicas([]ReplicaConnection{first, second}, 0, time.Second)
+	defer replicas.Close()
+
+	var result []Connection
+	for i := 0; i < 3; i++ {
+		conn, _ := replicas.Next()
+		result = append(result, conn)
+	}
+	if expected := []Connection{second, first, second}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v got %v", expected, result)
+	}
+
+	replicas.MarkDown(first)
+	replicas.MarkDown(second)
+	if _, ok := replicas.Next(); ok {
+		t.Errorf("expected no healthy replicas")
+	}
+}
+
+func TestReplicasHealthCheck(t *testing.T) {
+	var reads []string
+	conn := &fakeReadConn{name: "replica", reads: &reads}
+	conn.down.Store(true)
+
+	replicas := NewReplicas([]ReplicaConnection{conn}, 10*time.Millisecond, time.Second)
+	defer replicas.Close()
+
+	waitHealthy := func(expected bool) {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if _, ok := replicas.Next(); ok == expected {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("replica health didn't become %v", expected)
+	}
+
+	waitHealthy(false)
+	conn.down.Store(false)
+	waitHealthy(true)
+}
+
+func TestReadRouting(t *testing.T) {
+	testCases := []struct {
+		ctx           context.Context
+		replicaErr    error
+		expectedReads []string
+		expectedDown  bool
+	}{
+		{
+			ctx:           context.Background(),
+			expectedReads: []string{"replica"},
+		},
+		{
+			ctx:           WithReadYourWrites(context.Background()),
+			expectedReads: []string{"primary"},
+		},
+		{
+			ctx:           context.Background(),
+			replicaErr:    driver.ErrBadConn,
+			expectedReads: []string{"replica", "primary"},
+			expectedDown:  true,
+		},
+		{
+			ctx:           context.Background(),
+			replicaErr:    fmt.Errorf("syntax error"),
+			expectedReads: []string{"replica"},
+		},
+	}
+
+	for index, testCase := range testCases {
+		var reads []string
+		primary := &fakeReadConn{name: "primary", reads: &reads}
+		replica := &fakeReadConn{name: "replica", reads: &reads, readErr: testCase.replicaErr}
+
+		replicas := NewReplicas([]ReplicaConnection{replica}, 0, time.Second)
+		rep := NewMethodRepo(primary, WithReplicas(replicas))
+
+		_, _ = rep.List(testCase.ctx, 10, 0)
+
+		if !reflect.DeepEqual(reads, testCase.expectedReads) {
+			t.Errorf("failed testCase[%d], expected reads %v got %v", index, testCase.expectedReads, reads)
+		}
+		if _, ok := replicas.Next(); ok == testCase.expectedDown {
+			t.Errorf("failed testCase[%d], expected replica down %v", index, testCase.expectedDown)
+		}
+		replicas.Close()
+	}
+}
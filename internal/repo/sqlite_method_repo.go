@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+
+	"ova-method-api/internal/model"
+)
+
+// sqliteBulkChunkSize keeps the two bind parameters per row under the 32766 limit of sqlite
+const sqliteBulkChunkSize = 16000
+
+// sqliteMethodRepo stores methods in SQLite, which supports the RETURNING clause of the postgres queries,
+// so only the operations depending on the postgres protocol are replaced. The queries use ? placeholders,
+// the driver binds numbered ones much slower.
+type sqliteMethodRepo struct {
+	*methodRepo
+}
+
+func NewSQLiteMethodRepo(conn Connection, opts ...Option) MethodRepo {
+	return &sqliteMethodRepo{&methodRepo{baseRepo: newBaseRepo(conn, opts...), placeholder: squirrel.Question}}
+}
+
+func (rep *sqliteMethodRepo) Transaction(ctx context.Context, fn func(rep MethodRepo) error, opts ...TxOption) error {
+	return rep.baseRepo.Transaction(ctx, func(conn Connection) error {
+		return fn(NewSQLiteMethodRepo(conn, WithTimeouts(rep.timeouts)))
+	}, opts...)
+}
+
+// BulkAdd inserts items by chunks of Add in a single transaction, so either all items are saved or none.
+func (rep *sqliteMethodRepo) BulkAdd(ctx context.Context, items []model.Method) ([]model.Method, error) {
+	ctx, cancel := withTimeout(ctx, rep.timeouts.Bulk)
+	defer cancel()
+
+	var result []model.Method
+	err := rep.Transaction(ctx, func(tx MethodRepo) error {
+		result = make([]model.Method, 0, len(items))
+		for start := 0; start < len(items); start += sqliteBulkChunkSize {
+			end := start + sqliteBulkChunkSize
+			if end > len(items) {
+				end = len(items)
+			}
+
+			saved, err := tx.Add(ctx, items[start:end])
+			if err != nil {
+				return err
+			}
+			result = append(result, saved...)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+
+	"ova-method-api/internal/migrate"
+	"ova-method-api/migrations"
+)
+
+func openSQLite(t *testing.T) *sqlx.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "ova.db") + "?_pragma=busy_timeout(5000)&_time_format=sqlite&_txlock=immediate"
+	db, err := sqlx.Connect("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("failed open sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	source, err := migrations.ForDriver("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrate.New(db.DB, "sqlite", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed migrate sqlite: %v", err)
+	}
+
+	return db
+}
+
+func TestSQLiteMethodRepoConformance(t *testing.T) {
+	testMethodRepoConformance(t, func(t *testing.T) MethodRepo {
+		return NewSQLiteMethodRepo(openSQLite(t))
+	})
+}
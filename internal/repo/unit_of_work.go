@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+)
+
+//go:generate mockgen -source=$GOFILE -destination=./mock/unit_of_work.go -package=mock
+
+// UnitOfWork hands out repositories bound to the same transaction.
+type UnitOfWork interface {
+	Methods() MethodRepo
+	DeadLetters() DeadLetterRepo
+}
+
+// TxManager runs units of work. The transaction is also carried by the context passed to fn,
+// so any repository called with this context joins the transaction, and a nested Do
+// runs under a savepoint of the outer transaction.
+type TxManager interface {
+	Do(ctx context.Context, fn func(ctx context.Context, uow UnitOfWork) error, opts ...TxOption) error
+}
+
+// MethodRepoFactory creates the method repository of the database driver, e.g. NewMethodRepo or NewSQLiteMethodRepo.
+type MethodRepoFactory func(conn Connection, opts ...Option) MethodRepo
+
+type txManager struct {
+	baseRepo
+
+	newMethods MethodRepoFactory
+}
+
+// NewTxManager returns the manager whose units of work create the method repositories by newMethods,
+// the repositories get the timeouts of opts.
+func NewTxManager(conn Transactionable, newMethods MethodRepoFactory, opts ...Option) TxManager {
+	return &txManager{baseRepo: newBaseRepo(conn, opts...), newMethods: newMethods}
+}
+
+func (m *txManager) Do(ctx context.Context, fn func(ctx context.Context, uow UnitOfWork) error, opts ...TxOption) error {
+	return m.Transaction(ctx, func(conn Connection) error {
+		tx := conn.(*txConnection)
+		return fn(withTx(ctx, tx), &unitOfWork{conn: tx, manager: m})
+	}, opts...)
+}
+
+type unitOfWork struct {
+	conn    Connection
+	manager *txManager
+}
+
+func (uow *unitOfWork) Methods() MethodRepo {
+	return uow.manager.newMethods(uow.conn, WithTimeouts(uow.manager.timeouts))
+}
+
+func (uow *unitOfWork) DeadLetters() DeadLetterRepo {
+	return NewDeadLetterRepo(uow.conn)
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sqlx.NewDb(sql.OpenDB(connector), "fake")
+
+	manager := NewTxManager(db, NewMethodRepo)
+	methods := NewMethodRepo(db)
+
+	err := manager.Do(context.Background(), func(ctx context.Context, uow UnitOfWork) error {
+		if _, err := uow.Methods().Remove(ctx, 1); err != nil {
+			return err
+		}
+		if err := uow.DeadLetters().Remove(ctx, 2); err != nil {
+			return err
+		}
+		// the repository created outside of the unit of work joins the transaction from ctx
+		if _, err := methods.Remove(ctx, 3); err != nil {
+			return err
+		}
+
+		return manager.Do(ctx, func(ctx context.Context, uow UnitOfWork) error {
+			_, err := uow.Methods().Remove(ctx, 4)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	expected := []string{
+		"DELETE FROM methods WHERE id = $1 RETURNING id, user_id, value, created_at",
+		"DELETE FROM dead_letters WHERE id = $1",
+		"DELETE FROM methods WHERE id = $1 RETURNING id, user_id, value, created_at",
+		"SAVEPOINT sp_1",
+		"DELETE FROM methods WHERE id = $1 RETURNING id, user_id, value, created_at",
+		"RELEASE SAVEPOINT sp_1",
+	}
+	if len(connector.begins) != 1 {
+		t.Errorf("expected 1 transaction got %d", len(connector.begins))
+	}
+	if !reflect.DeepEqual(connector.queries, expected) {
+		t.Errorf("expected queries %v got %v", expected, connector.queries)
+	}
+	if len(connector.plainQueries) != 0 {
+		t.Errorf("unexpected queries outside of the transaction %v", connector.plainQueries)
+	}
+
+	if _, err = methods.Remove(context.Background(), 5); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if len(connector.plainQueries) != 1 {
+		t.Errorf("expected the query outside of the transaction, got %v", connector.plainQueries)
+	}
+}
+
+func TestUnitOfWorkRepoFactory(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sqlx.NewDb(sql.OpenDB(connector), "fake")
+	timeouts := Timeouts{Read: time.Second, Write: 2 * time.Second}
+
+	manager := NewTxManager(db, NewSQLiteMethodRepo, WithTimeouts(timeouts))
+
+	err := manager.Do(context.Background(), func(ctx context.Context, uow UnitOfWork) error {
+		methods, ok := uow.Methods().(*sqliteMethodRepo)
+		if !ok {
+			t.Fatalf("expected the sqlite repository got %T", uow.Methods())
+		}
+		if methods.timeouts != timeouts {
+			t.Errorf("expected timeouts %+v got %+v", timeouts, methods.timeouts)
+		}
+		_, err := methods.Remove(ctx, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	expected := []string{"DELETE FROM methods WHERE id = ? RETURNING id, user_id, value, created_at"}
+	if !reflect.DeepEqual(connector.queries, expected) {
+		t.Errorf("expected queries %v got %v", expected, connector.queries)
+	}
+}
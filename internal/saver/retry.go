@@ -0,0 +1,39 @@
+package saver
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how a failed flush is retried.
+// The delay before the n-th retry is BaseDelay*2^(n-1) capped by MaxDelay
+// and reduced by a random fraction of up to Jitter.
+type RetryPolicy struct {
+	MaxAttempts uint
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 2,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.2,
+}
+
+func (p RetryPolicy) delay(attempt uint) time.Duration {
+	delay := p.BaseDelay
+	for i := uint(1); i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
@@ -2,6 +2,7 @@ package saver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -9,10 +10,28 @@ import (
 	"github.com/rs/zerolog/log"
 	"ova-method-api/internal/flusher"
 	"ova-method-api/internal/model"
+	"ova-method-api/internal/monitoring"
+	"ova-method-api/internal/repo"
 )
 
 var (
 	ErrFlushBuffer = fmt.Errorf("failed flush buffer")
+	ErrBufferFull  = fmt.Errorf("buffer is full")
+	ErrSaverClosed = fmt.Errorf("saver is closed")
+)
+
+// BackpressurePolicy defines the behaviour of Save when the active buffer is full
+// and the previous one is still being flushed, or the unsaved items returned by
+// a failed flush fill the room of both buffers.
+type BackpressurePolicy int
+
+const (
+	// Block waits until the background flushes make room for the item.
+	Block BackpressurePolicy = iota
+	// DropOldest discards the oldest buffered item.
+	DropOldest
+	// Reject returns ErrBufferFull.
+	Reject
 )
 
 type Saver interface {
@@ -20,95 +39,504 @@ type Saver interface {
 	Close() error
 }
 
+type Option func(s *saver)
+
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(s *saver) {
+		s.policy = policy
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *saver) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithErrorClassifier overrides repo.IsTransient, only transient errors are retried.
+func WithErrorClassifier(isTransient func(err error) bool) Option {
+	return func(s *saver) {
+		s.isTransient = isTransient
+	}
+}
+
+// WithMaxBytes flushes the buffer once the total length of the buffered values reaches maxBytes.
+func WithMaxBytes(maxBytes int) Option {
+	return func(s *saver) {
+		s.maxBytes = maxBytes
+	}
+}
+
+// WithMaxAge flushes the buffer once the oldest buffered item waits longer than maxAge.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(s *saver) {
+		s.maxAge = maxAge
+	}
+}
+
+// WithWriteAheadLog persists buffered items, so they survive a crash of the process.
+// Items recovered by the log are flushed right after the start.
+func WithWriteAheadLog(wal *WriteAheadLog) Option {
+	return func(s *saver) {
+		s.wal = wal
+	}
+}
+
+// WithRejectHandler sets the callback receiving items failed with a permanent error.
+// Without the handler such items are logged and dropped.
+func WithRejectHandler(onReject func(item model.Method, err error)) Option {
+	return func(s *saver) {
+		s.onReject = onReject
+	}
+}
+
+func WithMetrics(metrics monitoring.SaverMetrics) Option {
+	return func(s *saver) {
+		s.metrics = metrics
+	}
+}
+
+type batch struct {
+	items []model.Method
+	// segment of the write-ahead log holding the items
+	segment string
+}
+
 type saver struct {
 	sync.Mutex
+	flushed *sync.Cond
 
-	retry uint
-	delay time.Duration
-	ctx   context.Context
+	capacity int
+	maxBytes int
+	maxAge   time.Duration
+	delay    time.Duration
+	policy   BackpressurePolicy
+	ctx      context.Context
+
+	retryPolicy RetryPolicy
+	isTransient func(err error) bool
+	onReject    func(item model.Method, err error)
+	metrics     monitoring.SaverMetrics
+
+	// buffer accepts new items while the previous one is flushed by the background worker
+	buffer      []model.Method
+	bufferBytes int
+	oldestAt    time.Time
+	firstItem   chan struct{}
+	flushing    bool
+	// inFlight is the number of items being flushed, they are returned to the buffer if the flush fails
+	inFlight int
+	batches  chan batch
+	wal      *WriteAheadLog
+
+	closed        bool
+	closeOnce     sync.Once
+	closeErr      error
+	done          chan struct{}
+	autoFlushDone chan struct{}
+	workerDone    chan struct{}
 
-	buffer  []model.Method
 	flusher flusher.Flusher
 }
 
-func New(ctx context.Context, capacity, delay uint, flusher flusher.Flusher) Saver {
+// New creates a saver which flushes the buffer when it holds capacity items, every delay
+// and on the triggers set by the options. A zero delay disables the periodic flush,
+// a zero capacity leaves the buffer unbounded, so it is flushed only by the other triggers.
+func New(ctx context.Context, capacity uint, delay time.Duration, flusher flusher.Flusher, opts ...Option) Saver {
 	s := &saver{
-		retry:   2,
-		ctx:     ctx,
-		flusher: flusher,
-		delay:   time.Duration(delay) * time.Second,
-		buffer:  make([]model.Method, 0, capacity),
+		ctx:      ctx,
+		flusher:  flusher,
+		capacity: int(capacity),
+		delay:    delay,
+		policy:   Block,
+
+		retryPolicy: defaultRetryPolicy,
+		isTransient: repo.IsTransient,
+		metrics:     monitoring.NewSaverMetrics(nil),
+
+		buffer:    make([]model.Method, 0, capacity),
+		batches:   make(chan batch, 1),
+		firstItem: make(chan struct{}, 1),
+
+		done:          make(chan struct{}),
+		autoFlushDone: make(chan struct{}),
+		workerDone:    make(chan struct{}),
 	}
+	s.flushed = sync.NewCond(&s.Mutex)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.runFlushWorker()
+
+	if s.wal != nil && len(s.wal.Recovered()) > 0 {
+		s.Lock()
+		s.addToBuffer(s.wal.Recovered()...)
+		s.swapBuffer()
+		s.Unlock()
+	}
+
 	go s.runAutoFlush()
 
 	return s
 }
 
 func (s *saver) runAutoFlush() {
-	withLock := func(fn func() error) {
-		s.Lock()
-		defer s.Unlock()
-		if err := fn(); err != nil {
-			log.Error().Err(err)
-		}
+	defer close(s.autoFlushDone)
+
+	var tick <-chan time.Time
+	if s.delay > 0 {
+		ticker := time.NewTicker(s.delay)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
 
+	// age fires when the oldest item of the buffer becomes overdue, it is armed by the first buffered item
+	var age <-chan time.Time
+	ageTimer := time.NewTimer(time.Hour)
+	ageTimer.Stop()
+	defer ageTimer.Stop()
+
 	for {
 		select {
-		case <-time.After(s.delay):
-			withLock(s.flushBuffer)
+		case <-tick:
+			s.Lock()
+			if !s.closed && !s.flushing && len(s.buffer) > 0 {
+				s.swapBuffer()
+			}
+			s.Unlock()
+		case <-s.firstItem:
+			resetTimer(ageTimer, s.maxAge)
+			age = ageTimer.C
+		case <-age:
+			age = nil
+
+			s.Lock()
+			if !s.closed && len(s.buffer) > 0 {
+				if remaining := s.maxAge - time.Since(s.oldestAt); remaining > 0 {
+					resetTimer(ageTimer, remaining)
+					age = ageTimer.C
+				} else if !s.flushing {
+					s.swapBuffer()
+				}
+				// otherwise the overdue buffer is swapped by the worker once the current flush is done
+			}
+			s.Unlock()
+		case <-s.done:
+			return
 		case <-s.ctx.Done():
-			withLock(s.flushBuffer)
+			s.closeOnce.Do(func() {
+				close(s.done)
+				s.closeErr = s.shutdown()
+				if s.closeErr != nil {
+					log.Error().Err(s.closeErr).Msg("failed flush saver buffer")
+				}
+			})
 			return
 		}
 	}
 }
 
-func (s *saver) flushBuffer() error {
-	for i := s.retry; i > 0; i-- {
-		if s.flushAndClear() {
-			return nil
+// runFlushWorker flushes swapped out buffers; unsaved items are returned to the active buffer.
+func (s *saver) runFlushWorker() {
+	defer close(s.workerDone)
+
+	for b := range s.batches {
+		unsaved, _ := s.flushBatch(s.ctx, b.items)
+
+		s.Lock()
+		if len(unsaved) > 0 {
+			s.buffer = append(unsaved, s.buffer...)
+			if s.policy == DropOldest && s.capacity > 0 && len(s.buffer) > s.capacity {
+				s.metrics.Dropped.Add(float64(len(s.buffer) - s.capacity))
+				s.buffer = s.buffer[len(s.buffer)-s.capacity:]
+			}
+			s.bufferBytes = valueBytes(s.buffer)
+			// the age of the returned items is counted anew, so a failing database isn't flushed in a loop
+			s.markFirstItem()
+			s.observeBuffer()
+		}
+		s.releaseSegment(b.segment, unsaved)
+		s.flushing = false
+		s.inFlight = 0
+		s.flushed.Broadcast()
+
+		if len(unsaved) == 0 && !s.closed && s.isOverdue() {
+			s.swapBuffer()
+		}
+		s.Unlock()
+	}
+}
+
+// swapBuffer hands the active buffer over to the flush worker, must be called under the lock.
+func (s *saver) swapBuffer() {
+	b := batch{items: s.buffer}
+	if s.wal != nil {
+		segment, err := s.wal.Rotate()
+		if err != nil {
+			log.Error().Err(err).Msg("failed rotate saver wal")
 		}
+		b.segment = segment
 	}
 
-	return ErrFlushBuffer
+	s.buffer = make([]model.Method, 0, s.capacity)
+	s.bufferBytes = 0
+	s.observeBuffer()
+	s.flushing = true
+	s.inFlight = len(b.items)
+	s.batches <- b
 }
 
-func (s *saver) flushAndClear() bool {
-	bufLen := len(s.buffer)
-	if bufLen == 0 {
+// addToBuffer must be called under the lock.
+func (s *saver) addToBuffer(items ...model.Method) {
+	if len(items) == 0 {
+		return
+	}
+	if len(s.buffer) == 0 {
+		s.markFirstItem()
+	}
+
+	s.buffer = append(s.buffer, items...)
+	s.bufferBytes += valueBytes(items)
+	s.observeBuffer()
+}
+
+func (s *saver) observeBuffer() {
+	s.metrics.BufferItems.Set(float64(len(s.buffer)))
+	s.metrics.BufferBytes.Set(float64(s.bufferBytes))
+}
+
+func (s *saver) markFirstItem() {
+	s.oldestAt = time.Now()
+	if s.maxAge <= 0 {
+		return
+	}
+
+	select {
+	case s.firstItem <- struct{}{}:
+	default:
+	}
+}
+
+// isFull reports whether the item doesn't fit into the active buffer, must be called under the lock.
+// Unsaved items returned to the buffer count against the capacity, so the saver holds
+// at most two buffers of items however long the flushes fail. An unbounded buffer is limited by maxBytes only.
+func (s *saver) isFull(item model.Method) bool {
+	if s.capacity > 0 && (len(s.buffer) >= s.capacity || len(s.buffer)+s.inFlight >= 2*s.capacity) {
 		return true
 	}
+	return s.maxBytes > 0 && len(s.buffer) > 0 && s.bufferBytes+len(item.Value) > s.maxBytes
+}
+
+// isOverdue reports whether the oldest buffered item waits longer than maxAge, must be called under the lock.
+func (s *saver) isOverdue() bool {
+	return s.maxAge > 0 && len(s.buffer) > 0 && time.Since(s.oldestAt) >= s.maxAge
+}
+
+func valueBytes(items []model.Method) int {
+	size := 0
+	for _, item := range items {
+		size += len(item.Value)
+	}
+	return size
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// releaseSegment removes the flushed segment of the write-ahead log,
+// unsaved items are moved to the current segment. Must be called under the lock.
+func (s *saver) releaseSegment(segment string, unsaved []model.Method) {
+	if s.wal == nil || segment == "" {
+		return
+	}
+
+	if err := s.wal.Append(unsaved...); err != nil {
+		log.Error().Err(err).Msg("failed append unsaved items to saver wal")
+		return
+	}
+	if err := s.wal.Remove(segment); err != nil {
+		log.Error().Err(err).Str("segment", segment).Msg("failed remove saver wal segment")
+	}
+}
+
+// flushBatch flushes the batch retrying transient failures, permanently failed items are rejected.
+// Items not flushed because ctx is cancelled are returned as unsaved.
+func (s *saver) flushBatch(ctx context.Context, batch []model.Method) ([]model.Method, error) {
+	if len(batch) > 0 {
+		startedAt := time.Now()
+		defer func() {
+			s.metrics.FlushDuration.Observe(time.Since(startedAt).Seconds())
+		}()
+	}
+
+	for attempt := uint(1); len(batch) > 0; attempt++ {
+		if attempt > 1 {
+			s.metrics.Retries.Inc()
+		}
+
+		result := s.flusher.Flush(ctx, batch)
+		s.metrics.Flushed.Add(float64(len(batch) - len(result.Failed)))
+
+		batch = make([]model.Method, 0, len(result.Failed))
+		for _, failure := range result.Failed {
+			if s.isTransient(failure.Err) || errors.Is(failure.Err, context.Canceled) {
+				batch = append(batch, failure.Item)
+				continue
+			}
+			s.reject(failure.Item, failure.Err)
+		}
+
+		if len(batch) == 0 || attempt >= s.retryPolicy.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-time.After(s.retryPolicy.delay(attempt)):
+		case <-ctx.Done():
+			return batch, ctx.Err()
+		}
+	}
 
-	unsaved := s.flusher.Flush(s.ctx, s.buffer)
+	if len(batch) > 0 {
+		return batch, ErrFlushBuffer
+	}
+	return nil, nil
+}
 
-	s.buffer = s.buffer[:0]
-	s.buffer = append(s.buffer, unsaved...)
+func (s *saver) reject(item model.Method, err error) {
+	s.metrics.Rejected.Inc()
+
+	if s.onReject != nil {
+		s.onReject(item, err)
+		return
+	}
 
-	return bufLen != len(s.buffer)
+	log.Error().
+		Uint64("user_id", item.UserId).
+		Str("value", item.Value).
+		Err(err).
+		Msg("item rejected by saver")
 }
 
+// Close stops background goroutines and flushes the buffer. It is safe to call Close several times,
+// the result of the first call is returned.
 func (s *saver) Close() error {
+	// the auto flush may be shutting the saver down on the cancelled context,
+	// so it is awaited outside of the once
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeErr = s.shutdown()
+	})
+	<-s.autoFlushDone
+
+	return s.closeErr
+}
+
+func (s *saver) shutdown() error {
 	s.Lock()
-	defer s.Unlock()
+	s.closed = true
+	for s.flushing {
+		s.flushed.Wait()
+	}
+	close(s.batches)
+
+	// the saver context may be already cancelled, the rest of the buffer is flushed anyway
+	ctx := s.ctx
+	if ctx.Err() != nil {
+		ctx = detachedContext{ctx}
+	}
+
+	unsaved, err := s.flushBatch(ctx, s.buffer)
+	s.buffer = append(s.buffer[:0], unsaved...)
+	s.bufferBytes = valueBytes(s.buffer)
+	s.observeBuffer()
+
+	if s.wal != nil {
+		// the current segment holds the saved items too, the unsaved ones are moved
+		// to a new segment, which is kept to be recovered on the next start
+		if len(unsaved) > 0 {
+			segment, rotateErr := s.wal.Rotate()
+			if rotateErr != nil {
+				log.Error().Err(rotateErr).Msg("failed rotate saver wal")
+			}
+			s.releaseSegment(segment, unsaved)
+		}
+		if walErr := s.wal.Close(len(unsaved) == 0); walErr != nil {
+			log.Error().Err(walErr).Msg("failed close saver wal")
+		}
+	}
+	s.Unlock()
 
-	return s.flushBuffer()
+	<-s.workerDone
+	return err
 }
 
 func (s *saver) Save(item model.Method) error {
 	s.Lock()
 	defer s.Unlock()
 
-	if !s.canAddToBuffer() {
-		if err := s.flushBuffer(); err != nil {
+	if s.closed {
+		return ErrSaverClosed
+	}
+
+	if s.isFull(item) {
+		if err := s.makeRoom(item); err != nil {
+			return err
+		}
+	}
+
+	if s.wal != nil {
+		if err := s.wal.Append(item); err != nil {
 			return err
 		}
 	}
 
-	s.buffer = append(s.buffer, item)
+	s.addToBuffer(item)
 	return nil
 }
 
-func (s *saver) canAddToBuffer() bool {
-	return cap(s.buffer) >= len(s.buffer)+1
+// makeRoom frees the active buffer according to the backpressure policy, must be called under the lock.
+func (s *saver) makeRoom(item model.Method) error {
+	if !s.flushing {
+		s.swapBuffer()
+		if !s.isFull(item) {
+			return nil
+		}
+		// the swapped buffer holds returned unsaved items and takes the room of both buffers
+	}
+
+	switch s.policy {
+	case DropOldest:
+		for len(s.buffer) > 0 && s.isFull(item) {
+			s.bufferBytes -= len(s.buffer[0].Value)
+			s.buffer = s.buffer[1:]
+			s.metrics.Dropped.Inc()
+		}
+		s.observeBuffer()
+	case Reject:
+		return ErrBufferFull
+	default:
+		for s.isFull(item) {
+			if !s.flushing {
+				s.swapBuffer()
+				continue
+			}
+
+			s.flushed.Wait()
+			if s.closed {
+				return ErrSaverClosed
+			}
+		}
+	}
+
+	return nil
 }
@@ -3,7 +3,11 @@ package saver
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,9 +15,11 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"ova-method-api/internal/flusher"
 	"ova-method-api/internal/model"
+	"ova-method-api/internal/monitoring"
 	"ova-method-api/internal/repo/mock"
 )
 
@@ -36,13 +42,14 @@ var _ = Describe("Saver", func() {
 	cancelableCtx, cancel := context.WithCancel(context.Background())
 
 	DescribeTable("Save success",
-		func(ctx context.Context, delay uint, fn func(ctx context.Context, s Saver)) {
+		func(ctx context.Context, delay time.Duration, fn func(ctx context.Context, s Saver)) {
 			var success bool
 			var wg sync.WaitGroup
 
 			wg.Add(1)
+			// the buffer left after the context is done is flushed with a detached context
 			rep.EXPECT().
-				Add(ctx, []model.Method{method}).
+				Add(gomock.Any(), []model.Method{method}).
 				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
 					defer wg.Done()
 					success = true
@@ -57,19 +64,19 @@ var _ = Describe("Saver", func() {
 			wg.Wait()
 			Expect(success).To(Equal(true))
 		},
-		Entry("flush after buffer full", defaultCtx, uint(10), func(ctx context.Context, s Saver) {
+		Entry("flush after buffer full", defaultCtx, 10*time.Second, func(ctx context.Context, s Saver) {
 			_ = s.Save(method)
 			_ = s.Save(method)
 		}),
-		Entry("flush after delay", defaultCtx, uint(1), func(ctx context.Context, s Saver) {
+		Entry("flush after delay", defaultCtx, 100*time.Millisecond, func(ctx context.Context, s Saver) {
 			_ = s.Save(method)
-			time.Sleep(1100 * time.Millisecond)
+			time.Sleep(150 * time.Millisecond)
 		}),
-		Entry("flush after close", defaultCtx, uint(10), func(ctx context.Context, s Saver) {
+		Entry("flush after close", defaultCtx, 10*time.Second, func(ctx context.Context, s Saver) {
 			_ = s.Save(method)
 			_ = s.Close()
 		}),
-		Entry("flush after context done", cancelableCtx, uint(10), func(ctx context.Context, s Saver) {
+		Entry("flush after context done", cancelableCtx, 10*time.Second, func(ctx context.Context, s Saver) {
 			_ = s.Save(method)
 			cancel()
 			time.Sleep(100 * time.Millisecond)
@@ -78,19 +85,436 @@ var _ = Describe("Saver", func() {
 
 	It("nothing to save", func() {
 		flushService := flusher.New(1, rep)
-		saverService := New(defaultCtx, 1, 1, flushService)
+		saverService := New(defaultCtx, 1, time.Second, flushService)
 		_ = saverService.Close()
 	})
 
+	Describe("flush triggers", func() {
+		var (
+			triggerCtrl *gomock.Controller
+			triggerRep  *mock.MockMethodRepo
+			flushed     chan []model.Method
+		)
+
+		BeforeEach(func() {
+			triggerCtrl = gomock.NewController(GinkgoT())
+			triggerRep = mock.NewMockMethodRepo(triggerCtrl)
+			flushed = make(chan []model.Method, 2)
+
+			triggerRep.EXPECT().
+				Add(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					flushed <- items
+					return nil, nil
+				}).
+				AnyTimes()
+		})
+
+		AfterEach(func() {
+			triggerCtrl.Finish()
+		})
+
+		It("flush when max bytes reached", func() {
+			first := model.Method{UserId: 1, Value: "1234"}
+			second := model.Method{UserId: 2, Value: "5678"}
+
+			saverService := New(defaultCtx, 10, 0, flusher.New(10, triggerRep), WithMaxBytes(6))
+			Expect(saverService.Save(first)).To(BeNil())
+			Expect(saverService.Save(second)).To(BeNil())
+
+			Eventually(flushed).Should(Receive(Equal([]model.Method{first})))
+			Expect(saverService.Close()).To(BeNil())
+			Eventually(flushed).Should(Receive(Equal([]model.Method{second})))
+		})
+
+		It("flush when oldest item is overdue", func() {
+			saverService := New(defaultCtx, 10, 0, flusher.New(10, triggerRep), WithMaxAge(50*time.Millisecond))
+			Expect(saverService.Save(method)).To(BeNil())
+
+			Eventually(flushed, time.Second).Should(Receive(Equal([]model.Method{method})))
+			Expect(saverService.Close()).To(BeNil())
+		})
+
+		It("flush unbounded buffer on close", func() {
+			saverService := New(defaultCtx, 0, 0, flusher.New(10, triggerRep))
+
+			items := make([]model.Method, 0, 3)
+			for i := uint64(1); i <= 3; i++ {
+				items = append(items, model.Method{UserId: i})
+				Expect(saverService.Save(items[i-1])).To(BeNil())
+			}
+			Consistently(flushed, 100*time.Millisecond).ShouldNot(Receive())
+
+			Expect(saverService.Close()).To(BeNil())
+			Eventually(flushed).Should(Receive(Equal(items)))
+		})
+	})
+
+	Describe("buffer is being flushed", func() {
+		var (
+			busyCtrl *gomock.Controller
+			busyRep  *mock.MockMethodRepo
+			release  chan struct{}
+			flushed  chan []model.Method
+		)
+
+		BeforeEach(func() {
+			busyCtrl = gomock.NewController(GinkgoT())
+			busyRep = mock.NewMockMethodRepo(busyCtrl)
+			release = make(chan struct{})
+			flushed = make(chan []model.Method, 2)
+
+			busyRep.EXPECT().
+				Add(defaultCtx, gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					<-release
+					flushed <- items
+					return nil, nil
+				}).
+				AnyTimes()
+		})
+
+		AfterEach(func() {
+			busyCtrl.Finish()
+		})
+
+		It("reject when both buffers are busy", func() {
+			saverService := New(defaultCtx, 1, 10*time.Second, flusher.New(1, busyRep), WithBackpressure(Reject))
+
+			Expect(saverService.Save(model.Method{UserId: 1})).To(BeNil())
+			Expect(saverService.Save(model.Method{UserId: 2})).To(BeNil())
+			Expect(saverService.Save(model.Method{UserId: 3})).To(Equal(ErrBufferFull))
+
+			close(release)
+			Expect(saverService.Close()).To(BeNil())
+			Expect(<-flushed).To(Equal([]model.Method{{UserId: 1}}))
+			Expect(<-flushed).To(Equal([]model.Method{{UserId: 2}}))
+		})
+
+		It("drop oldest when both buffers are busy", func() {
+			metrics := monitoring.NewSaverMetrics(nil)
+			saverService := New(defaultCtx, 1, 10*time.Second, flusher.New(1, busyRep),
+				WithBackpressure(DropOldest),
+				WithMetrics(metrics),
+			)
+
+			Expect(saverService.Save(model.Method{UserId: 1})).To(BeNil())
+			Expect(saverService.Save(model.Method{UserId: 2})).To(BeNil())
+			Expect(saverService.Save(model.Method{UserId: 3})).To(BeNil())
+			Expect(testutil.ToFloat64(metrics.BufferItems)).To(Equal(1.0))
+
+			close(release)
+			Expect(saverService.Close()).To(BeNil())
+			Expect(<-flushed).To(Equal([]model.Method{{UserId: 1}}))
+			Expect(<-flushed).To(Equal([]model.Method{{UserId: 3}}))
+
+			Expect(testutil.ToFloat64(metrics.Dropped)).To(Equal(1.0))
+			Expect(testutil.ToFloat64(metrics.Flushed)).To(Equal(2.0))
+			Expect(testutil.ToFloat64(metrics.BufferItems)).To(Equal(0.0))
+		})
+	})
+
+	Describe("repo keeps failing", func() {
+		var (
+			failingCtrl *gomock.Controller
+			failingRep  *mock.MockMethodRepo
+			maxBatch    atomic.Int64
+			metrics     monitoring.SaverMetrics
+		)
+
+		newSaver := func(policy BackpressurePolicy) Saver {
+			return New(defaultCtx, 2, 0, flusher.New(100, failingRep),
+				WithBackpressure(policy),
+				WithMetrics(metrics),
+				WithErrorClassifier(func(err error) bool { return true }),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			)
+		}
+
+		BeforeEach(func() {
+			failingCtrl = gomock.NewController(GinkgoT())
+			failingRep = mock.NewMockMethodRepo(failingCtrl)
+			metrics = monitoring.NewSaverMetrics(nil)
+			maxBatch.Store(0)
+
+			failingRep.EXPECT().
+				Add(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					if size := int64(len(items)); size > maxBatch.Load() {
+						maxBatch.Store(size)
+					}
+					time.Sleep(time.Millisecond)
+					return nil, flushErr
+				}).
+				AnyTimes()
+		})
+
+		AfterEach(func() {
+			failingCtrl.Finish()
+		})
+
+		It("reject keeps the buffer bounded", func() {
+			saverService := newSaver(Reject)
+
+			rejected := 0
+			for i := 0; i < 50; i++ {
+				if err := saverService.Save(model.Method{UserId: uint64(i + 1)}); err == ErrBufferFull {
+					rejected++
+				}
+				Expect(testutil.ToFloat64(metrics.BufferItems)).To(BeNumerically("<=", 4))
+				time.Sleep(time.Millisecond)
+			}
+
+			Expect(saverService.Close()).To(Equal(ErrFlushBuffer))
+			Expect(rejected).To(BeNumerically(">=", 46))
+			Expect(maxBatch.Load()).To(BeNumerically("<=", 4))
+		})
+
+		It("block waits while unsaved items fill both buffers", func() {
+			saverService := newSaver(Block)
+
+			saved := make(chan error, 10)
+			go func() {
+				for i := 0; i < 10; i++ {
+					saved <- saverService.Save(model.Method{UserId: uint64(i + 1)})
+				}
+			}()
+
+			Eventually(saved).Should(HaveLen(4))
+			Consistently(saved, 100*time.Millisecond).Should(HaveLen(4))
+			Expect(maxBatch.Load()).To(BeNumerically("<=", 4))
+
+			Expect(saverService.Close()).To(Equal(ErrFlushBuffer))
+			Eventually(saved).Should(HaveLen(10))
+			for i := 0; i < 10; i++ {
+				if i < 4 {
+					Expect(<-saved).To(BeNil())
+				} else {
+					Expect(<-saved).To(Equal(ErrSaverClosed))
+				}
+			}
+		})
+	})
+
+	It("close twice", func() {
+		saverService := New(defaultCtx, 1, time.Second, flusher.New(1, rep))
+
+		Expect(saverService.Close()).To(BeNil())
+		Expect(saverService.Close()).To(BeNil())
+	})
+
+	It("close while context is cancelled", func() {
+		localCtrl := gomock.NewController(GinkgoT())
+		defer localCtrl.Finish()
+
+		localRep := mock.NewMockMethodRepo(localCtrl)
+		localRep.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+		for i := 0; i < 100; i++ {
+			ctx, cancelCtx := context.WithCancel(context.Background())
+			saverService := New(ctx, 10, time.Second, flusher.New(10, localRep))
+			Expect(saverService.Save(method)).To(BeNil())
+
+			// the auto flush sees both the cancelled context and the closing saver
+			closed := make(chan error, 1)
+			cancelCtx()
+			go func() {
+				closed <- saverService.Close()
+			}()
+
+			Eventually(closed, time.Second).Should(Receive(BeNil()))
+		}
+	})
+
+	It("save after close", func() {
+		saverService := New(defaultCtx, 1, time.Second, flusher.New(1, rep))
+		_ = saverService.Close()
+
+		Expect(saverService.Save(method)).To(Equal(ErrSaverClosed))
+	})
+
+	It("save after context done", func() {
+		ctx, cancelCtx := context.WithCancel(context.Background())
+
+		localCtrl := gomock.NewController(GinkgoT())
+		defer localCtrl.Finish()
+
+		localRep := mock.NewMockMethodRepo(localCtrl)
+		localRep.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+		saverService := New(ctx, 1, 10*time.Second, flusher.New(1, localRep))
+
+		cancelCtx()
+		Eventually(func() error {
+			return saverService.Save(method)
+		}).Should(Equal(ErrSaverClosed))
+		Expect(saverService.Close()).To(BeNil())
+	})
+
 	It("error after retry", func() {
 		rep.EXPECT().Add(defaultCtx, []model.Method{method}).Return(nil, flushErr)
 		rep.EXPECT().Add(defaultCtx, []model.Method{method}).Return(nil, flushErr)
 
 		flushService := flusher.New(1, rep)
-		saverService := New(defaultCtx, 1, 1, flushService)
+		saverService := New(defaultCtx, 1, time.Second, flushService,
+			WithErrorClassifier(func(err error) bool { return true }),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+		)
 
 		_ = saverService.Save(method)
 		err := saverService.Close()
 		Expect(err).To(Equal(ErrFlushBuffer))
+		Expect(saverService.Close()).To(Equal(ErrFlushBuffer))
+	})
+
+	It("stop retry delay when context is done", func() {
+		ctx, cancelCtx := context.WithCancel(context.Background())
+
+		localCtrl := gomock.NewController(GinkgoT())
+		defer localCtrl.Finish()
+
+		localRep := mock.NewMockMethodRepo(localCtrl)
+		failed := make(chan struct{})
+		flushed := make(chan []model.Method, 1)
+		gomock.InOrder(
+			localRep.EXPECT().Add(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					close(failed)
+					return nil, flushErr
+				}),
+			localRep.EXPECT().Add(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					flushed <- items
+					return nil, nil
+				}),
+		)
+
+		first := model.Method{UserId: 1}
+		second := model.Method{UserId: 2}
+		saverService := New(ctx, 1, 0, flusher.New(10, localRep),
+			WithErrorClassifier(func(err error) bool { return true }),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute}),
+		)
+		Expect(saverService.Save(first)).To(BeNil())
+		Expect(saverService.Save(second)).To(BeNil())
+		Eventually(failed).Should(BeClosed())
+
+		// the worker gives up waiting for the retry, the final flush saves its items
+		cancelCtx()
+		Eventually(flushed, time.Second).Should(Receive(Equal([]model.Method{first, second})))
+		Expect(saverService.Close()).To(BeNil())
+	})
+
+	It("reject permanent error without retry", func() {
+		rep.EXPECT().Add(defaultCtx, []model.Method{method}).Return(nil, flushErr)
+
+		var rejected []model.Method
+		saverService := New(defaultCtx, 1, time.Second, flusher.New(1, rep),
+			WithRejectHandler(func(item model.Method, err error) {
+				Expect(err).To(Equal(flushErr))
+				rejected = append(rejected, item)
+			}),
+		)
+
+		_ = saverService.Save(method)
+		Expect(saverService.Close()).To(BeNil())
+		Expect(rejected).To(Equal([]model.Method{method}))
+	})
+
+	Describe("write-ahead log", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "saver-wal")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		It("recover unflushed items", func() {
+			wal, err := OpenWriteAheadLog(dir, true)
+			Expect(err).To(BeNil())
+			Expect(wal.Recovered()).To(BeEmpty())
+
+			crashedSaver := New(defaultCtx, 10, 10*time.Second, flusher.New(1, rep), WithWriteAheadLog(wal))
+			Expect(crashedSaver.Save(method)).To(BeNil())
+
+			recoveredWal, err := OpenWriteAheadLog(dir, true)
+			Expect(err).To(BeNil())
+			Expect(recoveredWal.Recovered()).To(Equal([]model.Method{method}))
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			rep.EXPECT().
+				Add(defaultCtx, []model.Method{method}).
+				DoAndReturn(func(ctx context.Context, items []model.Method) ([]model.Method, error) {
+					defer wg.Done()
+					return nil, nil
+				})
+
+			saverService := New(defaultCtx, 10, 10*time.Second, flusher.New(1, rep), WithWriteAheadLog(recoveredWal))
+			wg.Wait()
+			Expect(saverService.Close()).To(BeNil())
+
+			segments, _ := filepath.Glob(filepath.Join(dir, segmentPattern))
+			Expect(segments).To(BeEmpty())
+		})
+
+		It("recover only unsaved items after partial flush", func() {
+			items := []model.Method{{UserId: 1}, {UserId: 2}, {UserId: 3}}
+
+			localCtrl := gomock.NewController(GinkgoT())
+			defer localCtrl.Finish()
+
+			localRep := mock.NewMockMethodRepo(localCtrl)
+			localRep.EXPECT().
+				Add(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, chunk []model.Method) ([]model.Method, error) {
+					if chunk[0].UserId == 2 {
+						return nil, flushErr
+					}
+					return chunk, nil
+				}).
+				Times(len(items))
+
+			wal, err := OpenWriteAheadLog(dir, true)
+			Expect(err).To(BeNil())
+
+			saverService := New(defaultCtx, 10, 0, flusher.New(1, localRep),
+				WithWriteAheadLog(wal),
+				WithErrorClassifier(func(err error) bool { return true }),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+			)
+			for _, item := range items {
+				Expect(saverService.Save(item)).To(BeNil())
+			}
+			Expect(saverService.Close()).To(Equal(ErrFlushBuffer))
+
+			recoveredWal, err := OpenWriteAheadLog(dir, true)
+			Expect(err).To(BeNil())
+			Expect(recoveredWal.Recovered()).To(Equal([]model.Method{items[1]}))
+			Expect(recoveredWal.Close(true)).To(BeNil())
+		})
+	})
+
+	DescribeTable("retry delay",
+		func(policy RetryPolicy, attempt uint, expected time.Duration) {
+			Expect(policy.delay(attempt)).To(Equal(expected))
+		},
+		Entry("first attempt", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, uint(1), time.Second),
+		Entry("third attempt", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, uint(3), 4*time.Second),
+		Entry("max delay", RetryPolicy{BaseDelay: time.Second, MaxDelay: 3 * time.Second}, uint(5), 3*time.Second),
+	)
+
+	It("retry delay with jitter", func() {
+		policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Second, Jitter: 0.5}
+		for i := 0; i < 10; i++ {
+			delay := policy.delay(1)
+			Expect(delay).To(BeNumerically(">=", 500*time.Millisecond))
+			Expect(delay).To(BeNumerically("<=", time.Second))
+		}
 	})
 })
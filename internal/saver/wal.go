@@ -0,0 +1,161 @@
+package saver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+
+	"ova-method-api/internal/model"
+)
+
+const (
+	segmentPattern = "segment-*.log"
+	segmentFormat  = "segment-%020d.log"
+)
+
+// WriteAheadLog keeps buffered items on disk until they are flushed.
+// Items are appended as json lines to the current segment; when the buffer is handed
+// over to the flush worker the segment is rotated and removed after a successful flush.
+type WriteAheadLog struct {
+	dir       string
+	sync      bool
+	seq       uint64
+	file      *os.File
+	recovered []model.Method
+}
+
+// OpenWriteAheadLog reads items left by the previous run, moves them to a new segment
+// and removes the old segments. Recovered items are loaded into the saver buffer on start.
+func OpenWriteAheadLog(dir string, sync bool) (*WriteAheadLog, error) {
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return nil, err
+	}
+
+	segments, err := filepath.Glob(filepath.Join(dir, segmentPattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segments)
+
+	wal := &WriteAheadLog{dir: dir, sync: sync}
+	for _, segment := range segments {
+		items, err := readSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		wal.recovered = append(wal.recovered, items...)
+
+		var seq uint64
+		if _, err = fmt.Sscanf(filepath.Base(segment), segmentFormat, &seq); err == nil && seq >= wal.seq {
+			wal.seq = seq + 1
+		}
+	}
+
+	if err = wal.openSegment(); err != nil {
+		return nil, err
+	}
+	if err = wal.Append(wal.recovered...); err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		if err = os.Remove(segment); err != nil {
+			return nil, err
+		}
+	}
+
+	return wal, nil
+}
+
+func readSegment(path string) ([]model.Method, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result []model.Method
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var item model.Method
+		if err = json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			// the last record may be partially written if the process crashed
+			log.Warn().Err(err).Str("segment", path).Msg("skip broken wal record")
+			continue
+		}
+		result = append(result, item)
+	}
+
+	return result, scanner.Err()
+}
+
+func (wal *WriteAheadLog) openSegment() error {
+	path := filepath.Join(wal.dir, fmt.Sprintf(segmentFormat, wal.seq))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	wal.seq++
+	wal.file = f
+	return nil
+}
+
+// Recovered returns items which were not flushed by the previous run.
+func (wal *WriteAheadLog) Recovered() []model.Method {
+	return wal.recovered
+}
+
+func (wal *WriteAheadLog) Append(items ...model.Method) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var data []byte
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	if _, err := wal.file.Write(data); err != nil {
+		return err
+	}
+	if wal.sync {
+		return wal.file.Sync()
+	}
+	return nil
+}
+
+// Rotate closes the current segment and returns its path.
+func (wal *WriteAheadLog) Rotate() (string, error) {
+	path := wal.file.Name()
+	if err := wal.file.Close(); err != nil {
+		return "", err
+	}
+
+	return path, wal.openSegment()
+}
+
+func (wal *WriteAheadLog) Remove(segment string) error {
+	return os.Remove(segment)
+}
+
+// Close closes the current segment, the segment is removed when truncate is set.
+func (wal *WriteAheadLog) Close(truncate bool) error {
+	if err := wal.file.Close(); err != nil {
+		return err
+	}
+	if truncate {
+		return os.Remove(wal.file.Name())
+	}
+	return nil
+}
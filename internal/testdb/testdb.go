@@ -0,0 +1,127 @@
+//go:build integration
+
+// Package testdb provides a Postgres database with applied migrations for integration tests.
+// The database from TEST_DATABASE_DSN is used when the variable is set,
+// otherwise an embedded Postgres is started on a free port.
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/jmoiron/sqlx"
+
+	"ova-method-api/internal/migrate"
+)
+
+const DsnEnv = "TEST_DATABASE_DSN"
+
+type Database struct {
+	*sqlx.DB
+
+	postgres   *embeddedpostgres.EmbeddedPostgres
+	runtimeDir string
+}
+
+// Start connects to the test database and applies the up migrations from migrationsDir.
+func Start(migrationsDir string) (*Database, error) {
+	db := &Database{}
+
+	dsn := os.Getenv(DsnEnv)
+	if dsn == "" {
+		var err error
+		if dsn, err = db.startEmbedded(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := sqlx.Connect("pgx", dsn)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	db.DB = conn
+
+	if err = db.migrate(migrationsDir); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (db *Database) startEmbedded() (string, error) {
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+
+	db.runtimeDir, err = ioutil.TempDir("", "testdb")
+	if err != nil {
+		return "", err
+	}
+
+	config := embeddedpostgres.DefaultConfig().
+		Port(port).
+		RuntimePath(db.runtimeDir).
+		Logger(ioutil.Discard)
+
+	db.postgres = embeddedpostgres.NewDatabase(config)
+	if err = db.postgres.Start(); err != nil {
+		db.postgres = nil
+		return "", fmt.Errorf("failed start embedded postgres: %w", err)
+	}
+
+	return config.GetConnectionURL() + "?sslmode=disable", nil
+}
+
+func freePort() (uint32, error) {
+	listen, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listen.Close()
+
+	return uint32(listen.Addr().(*net.TCPAddr).Port), nil
+}
+
+// migrate applies the pending migrations from migrationsDir.
+func (db *Database) migrate(migrationsDir string) error {
+	migrator, err := migrate.New(db.DB.DB, "pgx", os.DirFS(migrationsDir))
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
+
+// Truncate removes all rows of the tables and resets their sequences.
+func (db *Database) Truncate(tables ...string) error {
+	_, err := db.Exec(fmt.Sprintf("TRUNCATE %s RESTART IDENTITY", strings.Join(tables, ", ")))
+	return err
+}
+
+func (db *Database) Close() error {
+	var err error
+	if db.DB != nil {
+		err = db.DB.Close()
+	}
+
+	if db.postgres != nil {
+		if stopErr := db.postgres.Stop(); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+	if db.runtimeDir != "" {
+		_ = os.RemoveAll(db.runtimeDir)
+	}
+
+	return err
+}
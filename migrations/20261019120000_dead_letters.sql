@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+create table dead_letters
+(
+    id               bigserial     primary key,
+    topic            varchar(255)  not null,
+    key              varchar(255)  not null default '',
+    headers          text          not null default '{}',
+    payload          bytea         not null,
+    error            text          not null,
+    attempts         integer       not null default 1,
+    next_attempt_at  timestamp     not null default now(),
+    created_at       timestamp     not null default now()
+);
+
+create index dead_letters_next_attempt_at_idx on dead_letters (next_attempt_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table dead_letters;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+// Package migrations embeds the goose SQL migrations of the Postgres schema
+// and, in the sqlite directory, their SQLite counterparts.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// ForDriver returns the migrations of the database used through the driver.
+func ForDriver(driver string) (fs.FS, error) {
+	switch driver {
+	case "pgx":
+		return FS, nil
+	case "sqlite":
+		return fs.Sub(sqlite, "sqlite")
+	default:
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table methods
+(
+    id            integer       primary key autoincrement,
+    user_id       bigint        not null,
+    value         varchar(255)  not null,
+    created_at    timestamp     not null default current_timestamp
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table methods;
+-- +goose StatementEnd